@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/golang/glog"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes a driver call, it is written as one JSON line.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	Command   string    `json:"command"`
+	Operation string    `json:"operation"`
+	Service   string    `json:"service"`
+	Index     string    `json:"index"`
+	Before    string    `json:"before"`
+	After     string    `json:"after"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// AuditLog stores the audit records.
+type AuditLog interface {
+	Append(record *AuditRecord) error
+}
+
+// FileAuditLog appends the records to a JSONL file.
+type FileAuditLog struct {
+	Path string
+	lock sync.Mutex
+}
+
+func (fl *FileAuditLog) Append(record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	fl.lock.Lock()
+	defer fl.lock.Unlock()
+
+	f, err := os.OpenFile(fl.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// AuditClient is the part of the etcd client used by EtcdAuditLog.
+type AuditClient interface {
+	CreateInOrder(dir string, value string, ttl uint64) (*etcd.Response, error)
+}
+
+// EtcdAuditLog stores each record in an in-order key under Prefix.
+type EtcdAuditLog struct {
+	Client AuditClient
+	Prefix string
+}
+
+func (el *EtcdAuditLog) Append(record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = el.Client.CreateInOrder(el.Prefix, string(data), 0)
+	return err
+}
+
+// WithAudit appends a record of each call to the logs. A failure to write
+// a record is logged and does not fail the call.
+func WithAudit(logs ...AuditLog) DriverMiddleware {
+	origin := &AuditRecord{
+		User:    currentUser(),
+		Command: strings.Join(os.Args, " "),
+	}
+	origin.Host, _ = os.Hostname()
+
+	return func(next drivers.ServiceDriver) drivers.ServiceDriver {
+		return &wrappedDriver{next: next, wrap: func(operation string, s *Service, call ServiceAction) (*Service, error) {
+			record := *origin
+			record.Time = time.Now().UTC()
+			record.Operation = operation
+			record.Service = s.Name
+			record.Index = s.Index
+			record.Before = statusOf(s)
+
+			updated, err := call(s)
+			record.Result = auditResult(err)
+			if err != nil {
+				record.Error = err.Error()
+			}
+			if updated != nil {
+				record.After = statusOf(updated)
+			}
+
+			for _, log := range logs {
+				if auditErr := log.Append(&record); auditErr != nil {
+					glog.Errorf("Unable to write the audit record of %s of %s/%s : %v", operation, s.Name, s.Index, auditErr)
+				}
+			}
+			return updated, err
+		}}
+	}
+}
+
+// auditResult is ok, failed, or timeout for the calls that may still
+// succeed after WithTimeout gave up waiting for them.
+func auditResult(err error) string {
+	switch err.(type) {
+	case nil:
+		return "ok"
+	case *TimeoutError:
+		return "timeout"
+	default:
+		return "failed"
+	}
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
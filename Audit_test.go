@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	. "github.com/arkenio/goarken"
+	"github.com/coreos/go-etcd/etcd"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func auditTestService() *Service {
+	return &Service{Name: "nxio_000001", Index: "1",
+		Status: &Status{Expected: STARTED_STATUS, Current: STARTED_STATUS, Alive: "1"}}
+}
+
+func readAuditRecords(t *testing.T, path string) []*AuditRecord {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records := []*AuditRecord{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record := &AuditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			t.Fatalf("invalid audit line %q : %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestFileAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+	audit := WithAudit(&FileAuditLog{Path: path})
+
+	ChainDriver(&countingDriver{}, audit).Start(auditTestService())
+	ChainDriver(&countingDriver{failures: 1, err: errors.New("no such unit")}, audit).Stop(auditTestService())
+	ChainDriver(&countingDriver{delay: 100 * time.Millisecond}, audit, WithTimeout(10*time.Millisecond)).Passivate(auditTestService())
+
+	records := readAuditRecords(t, path)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+
+	expected := []struct {
+		operation, after, result, err string
+	}{
+		{"start", STARTED_STATUS, "ok", ""},
+		{"stop", "", "failed", "no such unit"},
+		{"passivate", "", "timeout", "passivate of nxio_000001/1 timed out after 10ms"},
+	}
+	for i, e := range expected {
+		r := records[i]
+		if r.Operation != e.operation || r.Service != "nxio_000001" || r.Index != "1" {
+			t.Errorf("record %d : unexpected call %s of %s/%s", i, r.Operation, r.Service, r.Index)
+		}
+		if r.Before != STARTED_STATUS || r.After != e.after {
+			t.Errorf("record %d : unexpected statuses %q -> %q", i, r.Before, r.After)
+		}
+		if r.Result != e.result || r.Error != e.err {
+			t.Errorf("record %d : expected %s (%s), got %s (%s)", i, e.result, e.err, r.Result, r.Error)
+		}
+		if r.User == "" || r.Host == "" || r.Command == "" || r.Time.IsZero() {
+			t.Errorf("record %d : expected the origin of the call, got %+v", i, r)
+		}
+	}
+}
+
+// fakeAuditClient records the CreateInOrder calls.
+type fakeAuditClient struct {
+	dirs   []string
+	values []string
+}
+
+func (f *fakeAuditClient) CreateInOrder(dir string, value string, ttl uint64) (*etcd.Response, error) {
+	f.dirs = append(f.dirs, dir)
+	f.values = append(f.values, value)
+	return &etcd.Response{Node: &etcd.Node{Key: dir + "/00000000000000000042", Value: value}}, nil
+}
+
+func TestEtcdAuditLog(t *testing.T) {
+	client := &fakeAuditClient{}
+	driver := ChainDriver(&countingDriver{}, WithAudit(&EtcdAuditLog{Client: client, Prefix: "/arkenctl/audit"}))
+
+	driver.Stop(auditTestService())
+
+	if len(client.dirs) != 1 || client.dirs[0] != "/arkenctl/audit" {
+		t.Fatalf("expected a record created in order in /arkenctl/audit, got %v", client.dirs)
+	}
+	record := &AuditRecord{}
+	if err := json.Unmarshal([]byte(client.values[0]), record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Operation != "stop" || record.Service != "nxio_000001" || record.Result != "ok" {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+// failingAuditLog always fails to store the records.
+type failingAuditLog struct{}
+
+func (failingAuditLog) Append(record *AuditRecord) error {
+	return errors.New("disk full")
+}
+
+func TestAuditFailureDoesNotFailTheCall(t *testing.T) {
+	d := &countingDriver{}
+	driver := ChainDriver(d, WithAudit(failingAuditLog{}))
+
+	if _, err := driver.Start(auditTestService()); err != nil {
+		t.Errorf("expected the call to succeed, got %v", err)
+	}
+	if d.calls != 1 {
+		t.Errorf("expected 1 call, got %d", d.calls)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// ServiceAction is a driver call on a service, such as Start, Stop or
+// Passivate.
+type ServiceAction func(service *Service) (*Service, error)
+
+type BulkResult struct {
+	Service *Service
+	Before  string
+	After   string
+	Err     error
+}
+
+// RunBulk runs the action on every service, with at most parallel calls at
+// the same time. Results are returned in the order of the services.
+func RunBulk(services []*Service, parallel int, action ServiceAction) []*BulkResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]*BulkResult, len(services))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, service := range services {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, service *Service) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			results[i] = runOne(service, action)
+		}(i, service)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func runOne(service *Service, action ServiceAction) *BulkResult {
+	result := &BulkResult{Service: service, Before: statusOf(service)}
+	updated, err := action(service)
+	result.Err = err
+	if updated != nil {
+		result.After = statusOf(updated)
+	}
+	return result
+}
+
+// bulkError returns an error if any of the operations failed.
+func bulkError(results []*BulkResult) error {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("%d of %d operations failed", failed, len(results))}
+	}
+	return nil
+}
+
+func printBulkResults(wr io.Writer, action string, results []*BulkResult) {
+	w := new(tabwriter.Writer)
+	w.Init(wr, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Name\tIndex\tAction\tBefore\tAfter\tResult")
+	fmt.Fprintln(w, "----\t-----\t------\t------\t-----\t------")
+	for _, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			status = fmt.Sprintf("failed : %v", result.Err)
+		}
+		fmt.Fprintln(w, strings.Join([]string{
+			result.Service.Name,
+			result.Service.Index,
+			action,
+			result.Before,
+			result.After,
+			status,
+		}, "\t"))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func bulkServices(count int) []*Service {
+	services := make([]*Service, count)
+	for i := range services {
+		services[i] = &Service{
+			Name:   fmt.Sprintf("nxio_%06d", i+1),
+			Index:  "1",
+			Status: &Status{Expected: STARTED_STATUS, Current: STARTED_STATUS, Alive: "1"},
+		}
+	}
+	return services
+}
+
+func TestRunBulkConcurrencyBound(t *testing.T) {
+	for _, parallel := range []int{0, 1, 3, 20} {
+		var lock sync.Mutex
+		running, max := 0, 0
+		action := func(s *Service) (*Service, error) {
+			lock.Lock()
+			running++
+			if running > max {
+				max = running
+			}
+			lock.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			lock.Lock()
+			running--
+			lock.Unlock()
+			return s, nil
+		}
+
+		RunBulk(bulkServices(10), parallel, action)
+
+		expected := parallel
+		if expected < 1 {
+			expected = 1
+		}
+		if expected > 10 {
+			expected = 10
+		}
+		if max != expected {
+			t.Errorf("parallel=%d : expected %d concurrent calls, got %d", parallel, expected, max)
+		}
+	}
+}
+
+func TestRunBulkResultOrder(t *testing.T) {
+	services := bulkServices(5)
+	driver := &recordingDriver{fail: map[string]error{"nxio_000002/1": errors.New("unit not found")}}
+	action := func(s *Service) (*Service, error) {
+		// the first services finish last
+		var index int
+		fmt.Sscanf(s.Name, "nxio_%d", &index)
+		time.Sleep(time.Duration(5-index) * 10 * time.Millisecond)
+
+		if _, err := driver.Stop(s); err != nil {
+			return nil, err
+		}
+		return &Service{Name: s.Name, Index: s.Index, Status: &Status{Expected: STOPPED_STATUS, Current: STOPPED_STATUS}}, nil
+	}
+
+	results := RunBulk(services, 5, action)
+
+	if len(results) != len(services) {
+		t.Fatalf("expected %d results, got %d", len(services), len(results))
+	}
+	for i, result := range results {
+		if result.Service != services[i] {
+			t.Errorf("result %d is for %s, expected %s", i, result.Service.Name, services[i].Name)
+		}
+		if result.Before != STARTED_STATUS {
+			t.Errorf("%s : expected before %s, got %s", result.Service.Name, STARTED_STATUS, result.Before)
+		}
+	}
+	if results[1].Err == nil || results[1].After != "" {
+		t.Errorf("expected nxio_000002 to fail without an after status, got %+v", results[1])
+	}
+	if results[0].Err != nil || results[0].After != STOPPED_STATUS {
+		t.Errorf("expected nxio_000001 to be stopped, got %+v", results[0])
+	}
+	if calls := driver.operations(); len(calls) != 5 || calls[0] != "stop nxio_000005/1" {
+		t.Errorf("expected the calls to run concurrently, got %v", calls)
+	}
+
+	out := &bytes.Buffer{}
+	printBulkResults(out, "stop", results)
+	lines := strings.Split(out.String(), "\n")
+	if !strings.HasPrefix(lines[3], "nxio_000002") || !strings.HasSuffix(lines[3], "failed : unit not found") {
+		t.Errorf("unexpected line for nxio_000002 : %q", lines[3])
+	}
+}
+
+func TestBulkError(t *testing.T) {
+	ok := &BulkResult{Service: &Service{Name: "nxio_000001"}}
+	failed := &BulkResult{Service: &Service{Name: "nxio_000002"}, Err: errors.New("unit not found")}
+
+	if err := bulkError([]*BulkResult{ok, ok}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := bulkError(nil); err != nil {
+		t.Errorf("expected no error without results, got %v", err)
+	}
+
+	err := bulkError([]*BulkResult{ok, failed, failed})
+	exitErr, isExit := err.(*ExitError)
+	if !isExit {
+		t.Fatalf("expected an ExitError, got %#v", err)
+	}
+	if exitErr.Code != 1 || exitErr.Message != "2 of 3 operations failed" {
+		t.Errorf("unexpected error %+v", exitErr)
+	}
+}
+
+func TestBulkErrorExitCode(t *testing.T) {
+	if os.Getenv("BULK_EXIT_TEST") != "" {
+		exitOnError(bulkError([]*BulkResult{{Service: &Service{}, Err: errors.New("unit not found")}}))
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestBulkErrorExitCode")
+	cmd.Env = append(os.Environ(), "BULK_EXIT_TEST=1")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	err := cmd.Run()
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.Success() {
+		t.Fatalf("expected a non-zero exit, got %v", err)
+	}
+	if stderr.String() != "1 of 1 operations failed\n" {
+		t.Errorf("unexpected stderr %q", stderr.String())
+	}
+}
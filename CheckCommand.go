@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/coreos/go-etcd/etcd"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	NagiosOK       = 0
+	NagiosWarning  = 1
+	NagiosCritical = 2
+	NagiosUnknown  = 3
+)
+
+var nagiosStatuses = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// maxListedErrors is the number of services in error listed in the status
+// line, the others are only counted.
+const maxListedErrors = 5
+
+// CheckCommand checks all the service clusters once and reports the result
+// as a Nagios/Icinga plugin : a status line with perfdata and an exit code.
+type CheckCommand struct {
+	Client   *etcd.Client
+	Cli      *cli.Context
+	Warning  int
+	Critical int
+	Out      io.Writer
+}
+
+func (cc *CheckCommand) Run(stop chan interface{}) error {
+	if !cc.Client.SyncCluster() {
+		fmt.Fprintln(cc.Out, "ARKEN UNKNOWN - unable to sync with etcd cluster")
+		return &ExitError{Code: NagiosUnknown}
+	}
+
+	w := CreateWatcherFromCli(cc.Cli, cc.Client)
+	code, line := cc.report(ComputeClusterStats(w.Services))
+	fmt.Fprintln(cc.Out, line)
+
+	if code != NagiosOK {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
+// report returns the exit code and the status line with its perfdata.
+// Thresholds that are turned off are left empty in the perfdata.
+func (cc *CheckCommand) report(stats *ClusterStats) (int, string) {
+	code := cc.exitCode(stats)
+
+	summary := fmt.Sprintf("%d services in error%s", stats.Errors, listErrors(stats.InError))
+	if stats.Warnings > 0 {
+		summary += fmt.Sprintf(", %d in warning", stats.Warnings)
+	}
+
+	return code, fmt.Sprintf("ARKEN %s - %s | errors=%d;%s;%s;0 warnings=%d;%s;;0 started=%d;;;0 passivated=%d;;;0",
+		nagiosStatuses[code], summary,
+		stats.Errors, threshold(cc.Warning), threshold(cc.Critical),
+		stats.Warnings, threshold(cc.Warning), stats.Started, stats.Passivated)
+}
+
+// exitCode is CRITICAL when at least Critical services are in error, and
+// WARNING when at least Warning services are in error or in warning.
+func (cc *CheckCommand) exitCode(stats *ClusterStats) int {
+	switch {
+	case cc.Critical > 0 && stats.Errors >= int64(cc.Critical):
+		return NagiosCritical
+	case cc.Warning > 0 && (stats.Errors >= int64(cc.Warning) || stats.Warnings >= int64(cc.Warning)):
+		return NagiosWarning
+	default:
+		return NagiosOK
+	}
+}
+
+func threshold(value int) string {
+	if value <= 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+func listErrors(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	if len(names) > maxListedErrors {
+		return fmt.Sprintf(" (%s, ...)", strings.Join(names[:maxListedErrors], ", "))
+	}
+	return fmt.Sprintf(" (%s)", strings.Join(names, ", "))
+}
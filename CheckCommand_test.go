@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckReport(t *testing.T) {
+	tests := []struct {
+		warning, critical int
+		stats             *ClusterStats
+		code              int
+		line              string
+	}{
+		{1, 10, &ClusterStats{Started: 120, Passivated: 40}, NagiosOK,
+			"ARKEN OK - 0 services in error | errors=0;1;10;0 warnings=0;1;;0 started=120;;;0 passivated=40;;;0"},
+		{1, 10, &ClusterStats{Errors: 2, InError: []string{"nxio_000472", "nxio_001538"}, Started: 118}, NagiosWarning,
+			"ARKEN WARNING - 2 services in error (nxio_000472, nxio_001538) | errors=2;1;10;0 warnings=0;1;;0 started=118;;;0 passivated=0;;;0"},
+		{1, 10, &ClusterStats{Warnings: 3, Started: 117}, NagiosWarning,
+			"ARKEN WARNING - 0 services in error, 3 in warning | errors=0;1;10;0 warnings=3;1;;0 started=117;;;0 passivated=0;;;0"},
+		{5, 10, &ClusterStats{Warnings: 3, Started: 117}, NagiosOK,
+			"ARKEN OK - 0 services in error, 3 in warning | errors=0;5;10;0 warnings=3;5;;0 started=117;;;0 passivated=0;;;0"},
+		{1, 2, &ClusterStats{Errors: 2, InError: []string{"a", "b"}}, NagiosCritical,
+			"ARKEN CRITICAL - 2 services in error (a, b) | errors=2;1;2;0 warnings=0;1;;0 started=0;;;0 passivated=0;;;0"},
+		{1, 0, &ClusterStats{Errors: 7, InError: []string{"a", "b", "c", "d", "e", "f", "g"}}, NagiosWarning,
+			"ARKEN WARNING - 7 services in error (a, b, c, d, e, ...) | errors=7;1;;0 warnings=0;1;;0 started=0;;;0 passivated=0;;;0"},
+		{0, 0, &ClusterStats{Errors: 7, Warnings: 1, InError: []string{"a"}}, NagiosOK,
+			"ARKEN OK - 7 services in error (a), 1 in warning | errors=7;;;0 warnings=1;;;0 started=0;;;0 passivated=0;;;0"},
+	}
+
+	for _, test := range tests {
+		cc := &CheckCommand{Warning: test.warning, Critical: test.critical}
+		code, line := cc.report(test.stats)
+		if code != test.code {
+			t.Errorf("%+v with warning=%d critical=%d : expected code %d, got %d",
+				test.stats, test.warning, test.critical, test.code, code)
+		}
+		if line != test.line {
+			t.Errorf("expected :\n%s\ngot :\n%s", test.line, line)
+		}
+	}
+}
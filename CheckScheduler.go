@@ -0,0 +1,163 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"sync"
+	"time"
+)
+
+const (
+	checkQueued = iota
+	checkRunning
+	checkWaiting
+)
+
+// CheckFunc checks a cluster and returns true if it has to be rechecked
+// after the grace period.
+type CheckFunc func(cluster *ServiceCluster, attempt int) bool
+
+// CheckScheduler runs cluster checks on a bounded pool of workers. A cluster
+// has at most one pending check at a time : updates received while its check
+// is queued, running or waiting for a recheck are coalesced into it, so that
+// a flaky service never delays the checks of the other ones.
+type CheckScheduler struct {
+	Workers     int
+	GracePeriod time.Duration
+	Check       CheckFunc
+
+	lock    sync.Mutex
+	pending map[string]*scheduledCheck
+	queue   chan *scheduledCheck
+	stop    chan struct{}
+	running sync.WaitGroup
+}
+
+type scheduledCheck struct {
+	cluster *ServiceCluster
+	attempt int
+	state   int
+	rerun   bool
+	timer   *time.Timer
+}
+
+func NewCheckScheduler(workers int, gracePeriod time.Duration, check CheckFunc) *CheckScheduler {
+	if workers < 1 {
+		workers = 1
+	}
+
+	s := &CheckScheduler{
+		Workers:     workers,
+		GracePeriod: gracePeriod,
+		Check:       check,
+		pending:     make(map[string]*scheduledCheck),
+		queue:       make(chan *scheduledCheck),
+		stop:        make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+// Schedule queues a check of the cluster, unless one is already pending.
+func (s *CheckScheduler) Schedule(cluster *ServiceCluster) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if sc, ok := s.pending[cluster.Name]; ok {
+		sc.cluster = cluster
+		if sc.state == checkRunning {
+			sc.rerun = true
+		}
+		return
+	}
+
+	sc := &scheduledCheck{cluster: cluster, state: checkQueued}
+	s.pending[cluster.Name] = sc
+	s.running.Add(1)
+	s.enqueue(sc)
+}
+
+// Pending returns the number of clusters that have a check queued, running or
+// waiting for a recheck.
+func (s *CheckScheduler) Pending() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.pending)
+}
+
+// Wait blocks until there is no more pending check.
+func (s *CheckScheduler) Wait() {
+	s.running.Wait()
+}
+
+func (s *CheckScheduler) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	close(s.stop)
+	for _, sc := range s.pending {
+		if sc.timer != nil {
+			sc.timer.Stop()
+		}
+	}
+}
+
+// enqueue must be called with the lock held. Sending is done asynchronously
+// so that callers never block on busy workers.
+func (s *CheckScheduler) enqueue(sc *scheduledCheck) {
+	sc.state = checkQueued
+	go func() {
+		select {
+		case s.queue <- sc:
+		case <-s.stop:
+		}
+	}()
+}
+
+func (s *CheckScheduler) work() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case sc := <-s.queue:
+			s.run(sc)
+		}
+	}
+}
+
+func (s *CheckScheduler) run(sc *scheduledCheck) {
+	s.lock.Lock()
+	sc.state = checkRunning
+	cluster, attempt := sc.cluster, sc.attempt
+	s.lock.Unlock()
+
+	recheck := s.Check(cluster, attempt)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case sc.rerun:
+		// The cluster changed during the check : check it again right away,
+		// without counting it as a new attempt.
+		sc.rerun = false
+		if !recheck {
+			sc.attempt = 0
+		}
+		s.enqueue(sc)
+	case recheck:
+		sc.attempt++
+		sc.state = checkWaiting
+		sc.timer = time.AfterFunc(s.GracePeriod, func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			sc.timer = nil
+			s.enqueue(sc)
+		})
+	default:
+		delete(s.pending, sc.cluster.Name)
+		s.running.Done()
+	}
+}
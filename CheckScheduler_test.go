@@ -0,0 +1,156 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkRecorder is a fake CheckFunc recording the checks it is given.
+type checkRecorder struct {
+	lock     sync.Mutex
+	checks   []*ServiceCluster
+	attempts []int
+}
+
+func (cr *checkRecorder) record(cluster *ServiceCluster, attempt int) {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	cr.checks = append(cr.checks, cluster)
+	cr.attempts = append(cr.attempts, attempt)
+}
+
+func (cr *checkRecorder) count() int {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	return len(cr.checks)
+}
+
+func TestCheckSchedulerCoalescesQueuedUpdates(t *testing.T) {
+	recorder := &checkRecorder{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := NewCheckScheduler(1, time.Hour, func(cluster *ServiceCluster, attempt int) bool {
+		if cluster.Name == "blocker" {
+			close(started)
+			<-release
+		}
+		recorder.record(cluster, attempt)
+		return false
+	})
+	defer s.Stop()
+
+	// The only worker is busy, so the updates of nxio_000001 stay queued
+	s.Schedule(&ServiceCluster{Name: "blocker"})
+	<-started
+	updates := []*ServiceCluster{{Name: "nxio_000001"}, {Name: "nxio_000001"}, {Name: "nxio_000001"}}
+	for _, update := range updates {
+		s.Schedule(update)
+	}
+	if pending := s.Pending(); pending != 2 {
+		t.Errorf("expected 2 pending checks, got %d", pending)
+	}
+
+	close(release)
+	s.Wait()
+
+	if len(recorder.checks) != 2 {
+		t.Fatalf("expected the updates to be coalesced into a single check, got %d checks", len(recorder.checks))
+	}
+	if recorder.checks[1] != updates[2] {
+		t.Error("expected the last update to be checked")
+	}
+}
+
+func TestCheckSchedulerRerunsAfterRunningCheck(t *testing.T) {
+	recorder := &checkRecorder{}
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	s := NewCheckScheduler(1, time.Hour, func(cluster *ServiceCluster, attempt int) bool {
+		recorder.record(cluster, attempt)
+		if recorder.count() == 1 {
+			started <- struct{}{}
+			<-release
+		}
+		return false
+	})
+	defer s.Stop()
+
+	first, second, third := &ServiceCluster{Name: "nxio_000001"}, &ServiceCluster{Name: "nxio_000001"}, &ServiceCluster{Name: "nxio_000001"}
+	s.Schedule(first)
+	<-started
+	s.Schedule(second)
+	s.Schedule(third)
+	close(release)
+	s.Wait()
+
+	if len(recorder.checks) != 2 {
+		t.Fatalf("expected a single rerun after the running check, got %d checks", len(recorder.checks))
+	}
+	if recorder.checks[1] != third {
+		t.Error("expected the rerun to check the last update")
+	}
+	if recorder.attempts[1] != 0 {
+		t.Errorf("expected the rerun not to count as an attempt, got %d", recorder.attempts[1])
+	}
+}
+
+func TestCheckSchedulerGraceRecheck(t *testing.T) {
+	recorder := &checkRecorder{}
+	grace := 50 * time.Millisecond
+	s := NewCheckScheduler(1, grace, func(cluster *ServiceCluster, attempt int) bool {
+		recorder.record(cluster, attempt)
+		return attempt < 2
+	})
+	defer s.Stop()
+
+	start := time.Now()
+	s.Schedule(&ServiceCluster{Name: "nxio_000001"})
+	s.Wait()
+
+	if elapsed := time.Since(start); elapsed < 2*grace {
+		t.Errorf("expected the rechecks to wait for the grace period, all done in %v", elapsed)
+	}
+	if len(recorder.attempts) != 3 || recorder.attempts[0] != 0 || recorder.attempts[1] != 1 || recorder.attempts[2] != 2 {
+		t.Errorf("expected attempts 0, 1 and 2, got %v", recorder.attempts)
+	}
+	if pending := s.Pending(); pending != 0 {
+		t.Errorf("expected no pending check after Wait, got %d", pending)
+	}
+}
+
+func TestCheckSchedulerBoundedWorkers(t *testing.T) {
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	recorder := &checkRecorder{}
+	s := NewCheckScheduler(2, time.Hour, func(cluster *ServiceCluster, attempt int) bool {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		recorder.record(cluster, attempt)
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+		return false
+	})
+	defer s.Stop()
+
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		s.Schedule(&ServiceCluster{Name: name})
+	}
+	s.Wait()
+
+	if recorder.count() != 6 {
+		t.Errorf("expected every cluster to be checked, got %d checks", recorder.count())
+	}
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 concurrent checks, got %d", maxRunning)
+	}
+}
@@ -3,56 +3,106 @@ package main
 import (
 	"bytes"
 	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/golang/glog"
 	metrics "github.com/rcrowley/go-metrics"
 	datadog "github.com/vistarmedia/go-datadog"
+	"net/http"
 	"os"
+	"sort"
+	"sync"
 	"time"
 	"fmt"
 )
 
+// errorState records since when a cluster is in error.
+type errorState struct {
+	Cluster   *ServiceCluster
+	Since     time.Time
+	LastError error
+}
+
 type ClusterWatcher struct {
 	Watcher       *Watcher
 	Client        *etcd.Client
 	SingleRun     bool
 	DataDogAPIKey string
+	MetricsListen string
 
 	CheckCount    int
 	GracePeriod   int
+	Workers       int
+
+	Notifier Notifier
+	Prober   *Prober
+
+
 
+	FlapThreshold int
+	FlapWindow    int
 
+	Election   *LeaderElection
+	StateStore StateStore
 
-	inError map[string]*ServiceCluster
+	Driver              drivers.ServiceDriver
+	Remediations        []*RemediationRule
+	RemediationInterval int
+	RemediationCooldown time.Duration
 
+	lock         sync.Mutex
+	saveLock     sync.Mutex
+	inError      map[string]*errorState
+	remediations map[string]*remediationState
+	flaps        *FlapDetector
+	scheduler    *CheckScheduler
 
-	dog *datadog.Client
+
+	dog      *datadog.Client
+	exporter *PrometheusExporter
 
 	errorsGauge     metrics.Gauge
 	warningsGauge     metrics.Gauge
 	startedGauge    metrics.Gauge
 	passivatedGauge metrics.Gauge
+	flappingGauge   metrics.Gauge
 }
 
 func (cw *ClusterWatcher) Watch(stop chan interface{}) error {
 
-	if cw.DataDogAPIKey != "" {
-		cw.errorsGauge = metrics.NewGauge()
-		cw.startedGauge = metrics.NewGauge()
-		cw.passivatedGauge = metrics.NewGauge()
-		cw.warningsGauge = metrics.NewGauge()
-
-		metrics.Register("arken.environments.stats.errors", cw.errorsGauge)
-		metrics.Register("arken.environments.stats.started", cw.startedGauge)
-		metrics.Register("arken.environments.stats.passivated", cw.passivatedGauge)
-		metrics.Register("arken.environments.stats.warning", cw.warningsGauge)
+	if cw.Notifier == nil {
+		cw.Notifier = &LogNotifier{}
+	}
+	// Notifiers may be slow : they are called from a dedicated goroutine
+	// so that they don't delay the checks
+	notifier := NewAsyncNotifier(cw.Notifier, NotificationQueueSize)
+	defer notifier.Close()
+	cw.Notifier = notifier
+
+	cw.errorsGauge = metrics.NewGauge()
+	cw.startedGauge = metrics.NewGauge()
+	cw.passivatedGauge = metrics.NewGauge()
+	cw.warningsGauge = metrics.NewGauge()
+	cw.flappingGauge = metrics.NewGauge()
+
+	metrics.Register("arken.environments.stats.errors", cw.errorsGauge)
+	metrics.Register("arken.environments.stats.started", cw.startedGauge)
+	metrics.Register("arken.environments.stats.passivated", cw.passivatedGauge)
+	metrics.Register("arken.environments.stats.warning", cw.warningsGauge)
+	metrics.Register("arken.environments.stats.flapping", cw.flappingGauge)
 
+	if cw.DataDogAPIKey != "" {
 		host, _ := os.Hostname()
 		cw.dog = datadog.New(host, cw.DataDogAPIKey)
 		go cw.dog.DefaultReporter().Start(30 * time.Second)
 
 	}
 
+	cw.exporter = NewPrometheusExporter()
+	if cw.MetricsListen != "" {
+		go cw.serveMetrics()
+	}
+
 	go cw.updateMetrics()
 
 	return cw.watchServiceKeys(stop)
@@ -66,130 +116,225 @@ func (cw *ClusterWatcher) updateMetrics() {
 	for {
 		select {
 		case <-ticker.C:
-			errors := int64(0)
-			passivated := int64(0)
-			started := int64(0)
-			warning := int64(0)
 			glog.Infof("Updating metrics...")
-			for _, cluster := range cw.Watcher.Services {
-				_, err := cw.Watcher.Services[cluster.Name].Next()
-				if err != nil {
-					if stError, ok := err.(StatusError); ok {
-						switch stError.ComputedStatus {
-						case PASSIVATED_STATUS:
-							passivated++
-							break
-						case WARNING_STATUS:
-							warning++
-							break;
-						case STARTING_STATUS, STOPPED_STATUS, STOPPING_STATUS:
-							break
-						default:
-							// If status is nil, then we can't say it's an error... it's in an unknown status
-							if stError.Status != nil {
-								glog.Infof("Cluster in error : %s", cluster.Name)
-								errors++
-							}
-						}
-					} else {
-						errors++
+			stats := ComputeClusterStats(cw.Watcher.Services)
+			glog.Infof("End metrics update...")
+
+			cw.errorsGauge.Update(stats.Errors)
+			cw.passivatedGauge.Update(stats.Passivated)
+			cw.startedGauge.Update(stats.Started)
+			cw.warningsGauge.Update(stats.Warnings)
+
+			cw.exporter.SetStatusCounts(map[string]int64{
+				ERROR_STATUS:      stats.Errors,
+				PASSIVATED_STATUS: stats.Passivated,
+				STARTED_STATUS:    stats.Started,
+				WARNING_STATUS:    stats.Warnings,
+			})
+			cw.exporter.SetServices(cw.serviceSamples())
+
+			ticker = time.NewTicker(interval)
+		}
+	}
+}
+
+// ClusterStats counts the service clusters by status.
+type ClusterStats struct {
+	Errors     int64
+	Warnings   int64
+	Started    int64
+	Passivated int64
+	InError    []string
+}
+
+func ComputeClusterStats(services map[string]*ServiceCluster) *ClusterStats {
+	stats := &ClusterStats{}
+	for _, cluster := range services {
+		_, err := cluster.Next()
+		if err != nil {
+			if stError, ok := err.(StatusError); ok {
+				switch stError.ComputedStatus {
+				case PASSIVATED_STATUS:
+					stats.Passivated++
+					break
+				case WARNING_STATUS:
+					stats.Warnings++
+					break
+				case STARTING_STATUS, STOPPED_STATUS, STOPPING_STATUS:
+					break
+				default:
+					// If status is nil, then we can't say it's an error... it's in an unknown status
+					if stError.Status != nil {
 						glog.Infof("Cluster in error : %s", cluster.Name)
+						stats.Errors++
+						stats.InError = append(stats.InError, cluster.Name)
 					}
-				} else {
-					started++
 				}
+			} else {
+				glog.Infof("Cluster in error : %s", cluster.Name)
+				stats.Errors++
+				stats.InError = append(stats.InError, cluster.Name)
 			}
-			glog.Infof("End metrics update...")
-
-			cw.errorsGauge.Update(errors)
-			cw.passivatedGauge.Update(passivated)
-			cw.startedGauge.Update(started)
-			cw.warningsGauge.Update(warning)
+		} else {
+			stats.Started++
+		}
+	}
+	sort.Strings(stats.InError)
+	return stats
+}
 
-			ticker = time.NewTicker(interval)
+func (cw *ClusterWatcher) serviceSamples() []serviceSample {
+	samples := []serviceSample{}
+	for _, cluster := range cw.Watcher.Services {
+		for _, service := range cluster.GetInstances() {
+			host := ""
+			if service.Location != nil {
+				host = service.Location.Host
+			}
+			samples = append(samples, serviceSample{
+				Name:   service.Name,
+				Index:  service.Index,
+				Host:   host,
+				Status: statusOf(service),
+			})
 		}
 	}
+	return samples
+}
+
+func (cw *ClusterWatcher) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", cw.exporter)
+
+	glog.Infof("Serving prometheus metrics on %s/metrics", cw.MetricsListen)
+	if err := http.ListenAndServe(cw.MetricsListen, mux); err != nil {
+		glog.Errorf("Unable to serve metrics on %s : %v", cw.MetricsListen, err)
+	}
 }
 
 func (cw *ClusterWatcher) watchServiceKeys(stop chan interface{}) error {
-	cw.inError = make(map[string]*ServiceCluster)
+	cw.inError = make(map[string]*errorState)
+	cw.remediations = make(map[string]*remediationState)
+	cw.flaps = NewFlapDetector(cw.FlapThreshold, time.Duration(cw.FlapWindow)*time.Second)
+	if cw.StateStore != nil {
+		cw.loadState()
+	}
+	cw.scheduler = NewCheckScheduler(cw.Workers, time.Duration(cw.GracePeriod)*time.Second, cw.check)
+	defer cw.scheduler.Stop()
 
-	// First check that no instance has to be passivated
-	var err error = nil
+	done := make(chan struct{})
+	defer close(done)
+
+	if cw.Election != nil && !cw.SingleRun {
+		cw.Notifier = &LeaderNotifier{Election: cw.Election, Notifier: cw.Notifier}
+		cw.Election.Campaign()
+		go cw.Election.Run(done)
+	}
 
+	// First check that no instance has to be passivated
 	for _, cluster := range cw.Watcher.Services {
-		err = cw.check(cluster)
-	}
-
-	if !cw.SingleRun {
-		// Then watch for changes
-		updateChannel := cw.Watcher.Listen()
-		for {
-			select {
-			case <-stop:
-				return nil
-			case serviceOrDomain := <-updateChannel:
-				if cluster, ok := serviceOrDomain.(*ServiceCluster); ok {
-					cw.check(cluster)
-				}
-			}
+		cw.scheduler.Schedule(cluster)
+	}
+
+	if cw.SingleRun {
+		cw.scheduler.Wait()
+
+		cw.lock.Lock()
+		defer cw.lock.Unlock()
+		if len(cw.inError) > 0 {
+			return fmt.Errorf("%d clusters are in error", len(cw.inError))
 		}
 		return nil
-	} else {
-		return err
 	}
 
-}
+	if len(cw.Remediations) > 0 {
+		go cw.remediationLoop(done)
+	}
+	if cw.FlapThreshold > 0 {
+		go cw.flappingLoop(done)
+	}
 
-func (cw *ClusterWatcher) check(cluster *ServiceCluster) error {
-	return cw.check0(cluster,0);
+	// Then watch for changes
+	updateChannel := cw.Watcher.Listen()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case serviceOrDomain := <-updateChannel:
+			if cluster, ok := serviceOrDomain.(*ServiceCluster); ok {
+				cw.scheduler.Schedule(cluster)
+			}
+		}
+	}
 }
 
-func (cw *ClusterWatcher) check0(cluster *ServiceCluster, checkCount int) error {
-	_, err := cw.Watcher.Services[cluster.Name].Next()
+// check checks the status of a cluster and returns true if it seems in error
+// but has to be rechecked before being marked as failed.
+func (cw *ClusterWatcher) check(cluster *ServiceCluster, checkCount int) bool {
+	start := time.Now()
+	_, err := cluster.Next()
+	if err == nil && cw.Prober != nil {
+		err = cw.Prober.ProbeCluster(cluster)
+	}
+	cw.exporter.ObserveCheck(time.Since(start))
 	if err != nil {
-		if stError, ok := err.(StatusError); ok {
+		if unreachable, ok := err.(UnreachableError); ok {
+			if checkCount >= cw.CheckCount {
+				cw.addInError(cluster, unreachable)
+			} else {
+				glog.Infof("Service %s seems unreachable, rechecking in %d seconds", cluster.Name, cw.GracePeriod)
+				return true
+			}
+		} else if stError, ok := err.(StatusError); ok {
 			switch stError.ComputedStatus {
 			case STARTING_STATUS, PASSIVATED_STATUS, STOPPED_STATUS, STOPPING_STATUS, WARNING_STATUS:
 				break
 			default:
 				// If status is nil, then we can't say it's an error... it's in an unknown status
 				if stError.Status != nil {
-					if(checkCount >= cw.CheckCount) {
+					if checkCount >= cw.CheckCount {
 						glog.Infof("Adding in error since checkCount is %d", checkCount)
 						cw.addInError(cluster, stError)
 					} else {
-						glog.Infof("Service seems in error, rechecking in %d seconds", cw.GracePeriod)
-						time.Sleep(time.Duration(cw.GracePeriod) * time.Second)
-						cw.check0(cluster, checkCount + 1)
+						glog.Infof("Service %s seems in error, rechecking in %d seconds", cluster.Name, cw.GracePeriod)
+						return true
 					}
 				}
 			}
 		} else {
 			cw.addInError(cluster, err)
 		}
-		return err
+		return false
 	}
 	cw.removeInError(cluster)
-	return nil
+	return false
 
 }
 
 func (cw *ClusterWatcher) addInError(cluster *ServiceCluster, err error) {
-	if _, ok := cw.inError[cluster.Name]; ok {
+	cw.lock.Lock()
+	state, alreadyInError := cw.inError[cluster.Name]
+	if !alreadyInError {
+		state = &errorState{Since: time.Now()}
+		cw.inError[cluster.Name] = state
+	}
+	state.Cluster = cluster
+	state.LastError = err
+
+	flapping, flapStarted := false, false
+	if !alreadyInError {
+		flapping, flapStarted = cw.flaps.Record(cluster, time.Now())
+	}
+	cw.lock.Unlock()
+
+	if alreadyInError {
 		glog.Errorf("Cluster %s is still in error, computedStatus : %v", cluster.Name, err)
 	} else {
 		glog.Errorf("Cluster %s is in error : %v ", cluster.Name, err)
 
-		cw.dog.PostEvent(&datadog.Event {
-			Title: fmt.Sprintf("IO instance %s entered error state",cluster.Name),
-			Text:      cw.getClusterDescriptionInMarkdown(cluster),
-			Priority: "normal",
-			Tags      : []string{fmt.Sprintf("ioinstance:%s", cluster.Name),"arkenwatch"},
-			AlertType : "error",
-		})
-
-		cw.inError[cluster.Name] = cluster
+		cw.notifyTransition(NotifyError, cluster, err, flapping, flapStarted)
+		cw.exporter.IncTransition(NotifyError)
+		cw.saveState()
 	}
 	var doc bytes.Buffer
 	renderService(cluster, "", &doc)
@@ -197,9 +342,67 @@ func (cw *ClusterWatcher) addInError(cluster *ServiceCluster, err error) {
 }
 
 
+func (cw *ClusterWatcher) newNotification(kind string, cluster *ServiceCluster, err error) *Notification {
+	n := &Notification{
+		Kind:           kind,
+		Cluster:        cluster.Name,
+		Text:           cw.getClusterDescriptionInMarkdown(cluster),
+		Tags:           []string{fmt.Sprintf("ioinstance:%s", cluster.Name), "arkenwatch"},
+		Time:           time.Now(),
+		ServiceCluster: cluster,
+	}
+	if err != nil {
+		n.Error = err.Error()
+	}
+	return n
+}
+
+// notifyTransition notifies an error or a recovery, unless the cluster is
+// flapping : only the start of the flapping is notified then.
+func (cw *ClusterWatcher) notifyTransition(kind string, cluster *ServiceCluster, err error, flapping bool, flapStarted bool) {
+	if flapStarted {
+		glog.Infof("Cluster %s is flapping", cluster.Name)
+		cw.notify(NotifyFlappingStart, cluster, err)
+		cw.updateFlappingMetrics()
+	} else if flapping {
+		glog.Infof("Cluster %s is flapping, %s notification suppressed", cluster.Name, kind)
+	} else {
+		cw.notify(kind, cluster, err)
+	}
+}
+
+func (cw *ClusterWatcher) notify(kind string, cluster *ServiceCluster, err error) {
+	n := cw.newNotification(kind, cluster, err)
+
+	switch kind {
+	case NotifyError:
+		n.Title = fmt.Sprintf("IO instance %s entered error state", cluster.Name)
+		n.AlertType = "error"
+		n.ErrorKind = ErrorKindStatus
+		if _, ok := err.(UnreachableError); ok {
+			n.Title = fmt.Sprintf("IO instance %s is unreachable", cluster.Name)
+			n.ErrorKind = ErrorKindUnreachable
+		}
+	case NotifyRecovery:
+		n.Title = fmt.Sprintf("IO instance %s recovered from error state", cluster.Name)
+		n.AlertType = "info"
+	case NotifyFlappingStart:
+		n.Title = fmt.Sprintf("IO instance %s is flapping, notifications are suspended", cluster.Name)
+		n.AlertType = "warning"
+	case NotifyFlappingEnd:
+		n.Title = fmt.Sprintf("IO instance %s stopped flapping", cluster.Name)
+		n.AlertType = "info"
+		if err != nil {
+			n.Title = fmt.Sprintf("IO instance %s stopped flapping and is in error state", cluster.Name)
+			n.AlertType = "error"
+		}
+	}
+
+	cw.Notifier.Notify(n)
+}
+
 func (cw *ClusterWatcher) getClusterDescriptionInMarkdown(cluster *ServiceCluster) string {
-	tpl := `%%%
-{{range $index, $service := .GetInstances }}
+	tpl := `{{range $index, $service := .GetInstances }}
 # Instance : {{.Name}}
 
     * Name : {{.Name}}
@@ -212,8 +415,7 @@ func (cw *ClusterWatcher) getClusterDescriptionInMarkdown(cluster *ServiceCluste
       * expected : {{.Status.Expected}}
       * current : {{.Status.Current}}
       * alive : {{.Status.Alive}}
-{{end}}
-%%%`
+{{end}}`
 
 	var doc bytes.Buffer
 	renderService(cluster, tpl, &doc)
@@ -227,22 +429,28 @@ func (cw *ClusterWatcher) getClusterDescriptionInMarkdown(cluster *ServiceCluste
 
 
 func (cw *ClusterWatcher) removeInError(cluster *ServiceCluster) {
-	if _, ok := cw.inError[cluster.Name]; ok {
+	cw.lock.Lock()
+	_, wasInError := cw.inError[cluster.Name]
+	delete(cw.inError, cluster.Name)
+	cw.recoverRemediations(cluster.Name, time.Now())
+
+	flapping, flapStarted := false, false
+	if wasInError {
+		flapping, flapStarted = cw.flaps.Record(cluster, time.Now())
+	}
+	cw.lock.Unlock()
+
+	if wasInError {
 		glog.Infof("Cluster %s is back to a stable state", cluster.Name)
 
-		cw.dog.PostEvent(&datadog.Event {
-			Title: fmt.Sprintf("IO instance %s recovered from error state",cluster.Name),
-			Text:      cw.getClusterDescriptionInMarkdown(cluster),
-			Priority: "normal",
-			Tags      : []string{fmt.Sprintf("ioinstance:%s", cluster.Name),"arkenwatch"},
-			AlertType : "info",
-		})
+		cw.notifyTransition(NotifyRecovery, cluster, nil, flapping, flapStarted)
+		cw.exporter.IncTransition(NotifyRecovery)
+		cw.saveState()
 
 
 
 		var doc bytes.Buffer
 		renderService(cluster, "", &doc)
 		glog.Errorf(doc.String())
-		delete(cw.inError, cluster.Name)
 	}
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
+	"github.com/codegangsta/cli"
+	"io"
+	"os"
+	"strings"
+)
+
+// DryRunDriver is used instead of the configured driver with --dry-run : it
+// only prints the calls that would be made.
+type DryRunDriver struct {
+	Name string
+	Out  io.Writer
+}
+
+func (d *DryRunDriver) Start(s *Service) (*Service, error) {
+	return d.print("Start", s)
+}
+
+func (d *DryRunDriver) Stop(s *Service) (*Service, error) {
+	return d.print("Stop", s)
+}
+
+func (d *DryRunDriver) Passivate(s *Service) (*Service, error) {
+	return d.print("Passivate", s)
+}
+
+func (d *DryRunDriver) print(call string, s *Service) (*Service, error) {
+	fmt.Fprintf(d.Out, "[dry-run] %s driver : %s(%s/%s) on %s\n", d.Name, call, s.Name, s.Index, s.NodeKey)
+	return s, nil
+}
+
+var _ drivers.ServiceDriver = (*DryRunDriver)(nil)
+
+// needsConfirmation returns true for destructive actions and for actions on
+// several instances.
+func needsConfirmation(action string, services []*Service) bool {
+	return action != "start" || len(services) > 1
+}
+
+// confirmationRequired returns true if the user must confirm the action,
+// that is if it needs a confirmation and neither --yes nor --dry-run is given.
+func confirmationRequired(c *cli.Context, action string, services []*Service) bool {
+	return !c.GlobalBool("yes") && !c.GlobalBool("dryRun") && needsConfirmation(action, services)
+}
+
+// confirm lists the instances the action will be run on and asks the user to
+// confirm. It fails if no answer can be read.
+func confirm(action string, services []*Service, in io.Reader, out io.Writer) (bool, error) {
+	fmt.Fprintf(out, "The following %d instances will be %s :\n", len(services), pastTense(action))
+	for _, service := range services {
+		fmt.Fprintf(out, "  %s/%s\t%s\t%s\n", service.Name, service.Index, service.Domain, statusOf(service))
+	}
+	fmt.Fprint(out, "Do you want to continue ? [y/N] ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, errNoConfirmation
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+var errNoConfirmation = &ExitError{Code: 1, Message: "Unable to ask for a confirmation, use --yes to skip it"}
+
+// isTerminal returns true if the file is a character device, such as a
+// terminal, rather than a pipe or a regular file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func pastTense(action string) string {
+	switch action {
+	case "stop":
+		return "stopped"
+	case "passivate":
+		return "passivated"
+	case "restart":
+		return "restarted"
+	default:
+		return action + "ed"
+	}
+}
+
+// runAction runs the action on the services once confirmed, and prints the
+// result for each of them.
+func runAction(c *cli.Context, action string, services []*Service, parallel int, serviceAction ServiceAction) error {
+	if len(services) == 0 {
+		fmt.Fprintln(os.Stderr, "No service selected")
+		return nil
+	}
+
+	if err := confirmAction(c, action, services); err != nil {
+		return err
+	}
+
+	results := RunBulk(services, parallel, serviceAction)
+	printBulkResults(os.Stdout, action, results)
+	return bulkError(results)
+}
+
+func confirmAction(c *cli.Context, action string, services []*Service) error {
+	if !confirmationRequired(c, action, services) {
+		return nil
+	}
+	// Scripts and cron jobs can't answer : fail instead of reading stdin
+	if !isTerminal(os.Stdin) {
+		return errNoConfirmation
+	}
+
+	confirmed, err := confirm(action, services, os.Stdin, os.Stderr)
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return &ExitError{Code: 1, Message: "Aborted, use --yes to skip the confirmation"}
+	}
+	return nil
+}
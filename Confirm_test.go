@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	. "github.com/arkenio/goarken"
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func confirmTestServices(n int) []*Service {
+	services := []*Service{}
+	for i := 1; i <= n; i++ {
+		services = append(services, &Service{Name: "nxio_000001", Index: strconv.Itoa(i), Domain: "nxio-000001.test.io",
+			Status: &Status{Expected: STARTED_STATUS, Current: STARTED_STATUS, Alive: "1"}})
+	}
+	return services
+}
+
+func TestNeedsConfirmation(t *testing.T) {
+	tests := []struct {
+		action   string
+		services int
+		expected bool
+	}{
+		{"start", 1, false},
+		{"start", 2, true},
+		{"stop", 1, true},
+		{"passivate", 1, true},
+		{"restart", 1, true},
+	}
+	for _, test := range tests {
+		if needsConfirmation(test.action, confirmTestServices(test.services)) != test.expected {
+			t.Errorf("%s on %d instances : expected %v", test.action, test.services, test.expected)
+		}
+	}
+}
+
+// confirmationRequiredWith returns confirmationRequired for the global flags.
+func confirmationRequiredWith(t *testing.T, action string, services []*Service, flags ...string) bool {
+	var required bool
+	app := cli.NewApp()
+	app.Flags = GetGlobalFlags()
+	app.Commands = []cli.Command{{
+		Name: "probe",
+		Action: func(c *cli.Context) {
+			required = confirmationRequired(c, action, services)
+		},
+	}}
+	if err := app.Run(append(append([]string{progname}, flags...), "probe")); err != nil {
+		t.Fatal(err)
+	}
+	return required
+}
+
+func TestConfirmationRequired(t *testing.T) {
+	services := confirmTestServices(2)
+	if !confirmationRequiredWith(t, "stop", services) {
+		t.Error("expected stop to be confirmed")
+	}
+	if confirmationRequiredWith(t, "stop", services, "--yes") || confirmationRequiredWith(t, "stop", services, "-y") {
+		t.Error("expected --yes to skip the confirmation")
+	}
+	if confirmationRequiredWith(t, "stop", services, "--dry-run") {
+		t.Error("expected --dry-run to skip the confirmation")
+	}
+	if confirmationRequiredWith(t, "start", services[:1]) {
+		t.Error("expected start on a single instance not to be confirmed")
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		answer    string
+		confirmed bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{" yes \n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"whatever\n", false},
+		{"y", true},
+	}
+	for _, test := range tests {
+		out := &bytes.Buffer{}
+		confirmed, err := confirm("stop", confirmTestServices(2), strings.NewReader(test.answer), out)
+		if err != nil {
+			t.Errorf("%q : %v", test.answer, err)
+		}
+		if confirmed != test.confirmed {
+			t.Errorf("%q : expected %v", test.answer, test.confirmed)
+		}
+		if !strings.Contains(out.String(), "The following 2 instances will be stopped") ||
+			!strings.Contains(out.String(), "nxio_000001/2") {
+			t.Errorf("expected the instances to be listed :\n%s", out)
+		}
+	}
+
+	// Without any answer, such as with stdin on /dev/null, it fails
+	_, err := confirm("stop", confirmTestServices(2), strings.NewReader(""), ioutil.Discard)
+	if err != errNoConfirmation {
+		t.Errorf("expected an error without answer, got %v", err)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := ioutil.TempFile("", "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if isTerminal(f) {
+		t.Error("expected a regular file not to be a terminal")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if isTerminal(r) {
+		t.Error("expected a pipe not to be a terminal")
+	}
+}
+
+func TestDryRunDriver(t *testing.T) {
+	out := &bytes.Buffer{}
+	driver := &DryRunDriver{Name: "fleet", Out: out}
+	service := &Service{Name: "nxio_000001", Index: "1", NodeKey: "/services/nxio_000001/1"}
+
+	for _, call := range []func(*Service) (*Service, error){driver.Start, driver.Stop, driver.Passivate} {
+		updated, err := call(service)
+		if err != nil || updated != service {
+			t.Errorf("expected the service to be returned unchanged, got %v, %v", updated, err)
+		}
+	}
+
+	expected := "[dry-run] fleet driver : Start(nxio_000001/1) on /services/nxio_000001/1\n" +
+		"[dry-run] fleet driver : Stop(nxio_000001/1) on /services/nxio_000001/1\n" +
+		"[dry-run] fleet driver : Passivate(nxio_000001/1) on /services/nxio_000001/1\n"
+	if out.String() != expected {
+		t.Errorf("expected :\n%s\ngot :\n%s", expected, out)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// ContextCommand manages the contexts of the configuration file.
+type ContextCommand struct {
+	Path string
+	Cli  *cli.Context
+	Out  io.Writer
+}
+
+func (cc *ContextCommand) load() (*ConfigFile, error) {
+	return LoadConfigFile(cc.Path)
+}
+
+func (cc *ContextCommand) List(stop chan interface{}) error {
+	config, err := cc.load()
+	if err != nil {
+		return err
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(cc.Out, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Current\tName\tetcdAddress\tDriver")
+	fmt.Fprintln(w, "-------\t----\t-----------\t------")
+	for _, name := range config.ContextNames() {
+		settings, _ := config.Settings(name)
+		current := ""
+		if name == config.CurrentContext {
+			current = "*"
+		}
+		fmt.Fprintln(w, strings.Join([]string{
+			current,
+			name,
+			settings["etcdAddress"],
+			settings["driver"],
+		}, "\t"))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+
+	return nil
+}
+
+func (cc *ContextCommand) Use(stop chan interface{}) error {
+	if len(cc.Cli.Args()) == 0 {
+		return errors.New("You must pass the context name as an argument")
+	}
+	name := cc.Cli.Args()[0]
+
+	config, err := cc.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Contexts[name]; !ok {
+		return fmt.Errorf("Unknown context %q, existing contexts are : %s", name, strings.Join(config.ContextNames(), ", "))
+	}
+
+	config.CurrentContext = name
+	if err := config.Save(cc.Path); err != nil {
+		return err
+	}
+	fmt.Fprintf(cc.Out, "Switched to context %s\n", name)
+	return nil
+}
+
+// Show prints the settings of the given context, or of the current one.
+// Secrets are masked.
+func (cc *ContextCommand) Show(stop chan interface{}) error {
+	config, err := cc.load()
+	if err != nil {
+		return err
+	}
+
+	name := cc.Cli.GlobalString("context")
+	if len(cc.Cli.Args()) > 0 {
+		name = cc.Cli.Args()[0]
+	}
+	if name == "" {
+		name = config.CurrentContext
+	}
+	if name == "" {
+		return errors.New("No current context, pass the context name as an argument")
+	}
+
+	settings, err := config.Settings(name)
+	if err != nil {
+		return err
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(cc.Out, 0, 8, 2, '\t', 0)
+	fmt.Fprintf(w, "Context\t%s\n", name)
+	fmt.Fprintln(w)
+	for _, key := range sortedSettings(settings) {
+		value := settings[key]
+		if strings.Contains(strings.ToLower(key), "secret") {
+			value = maskSecret(value)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", key, value)
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"github.com/codegangsta/cli"
+	"strings"
+	"testing"
+)
+
+// runContextCommand runs a context subcommand on the configuration file.
+func runContextCommand(t *testing.T, path string, args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	var err error
+	command := func(run func(*ContextCommand) Runnable) func(c *cli.Context) {
+		return func(c *cli.Context) {
+			err = run(&ContextCommand{Path: path, Cli: c, Out: out})(nil)
+		}
+	}
+
+	app := cli.NewApp()
+	app.Flags = GetGlobalFlags()
+	app.Commands = []cli.Command{
+		{Name: "list", Action: command(func(cc *ContextCommand) Runnable { return cc.List })},
+		{Name: "use", Action: command(func(cc *ContextCommand) Runnable { return cc.Use })},
+		{Name: "show", Action: command(func(cc *ContextCommand) Runnable { return cc.Show })},
+	}
+	if runErr := app.Run(append([]string{progname}, args...)); runErr != nil {
+		t.Fatal(runErr)
+	}
+	return out.String(), err
+}
+
+func TestContextUse(t *testing.T) {
+	path, cleanup := writeTestConfig(t)
+	defer cleanup()
+
+	if _, err := runContextCommand(t, path, "use", "staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.CurrentContext != "staging" {
+		t.Errorf("expected staging to be the current context, got %q", config.CurrentContext)
+	}
+	if names := config.ContextNames(); len(names) != 2 {
+		t.Errorf("expected the contexts to be kept, got %v", names)
+	}
+
+	out, err := runContextCommand(t, path, "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if current := fields[0] == "*"; current != strings.Contains(line, "staging") {
+			t.Errorf("expected only staging to be marked as current :\n%s", out)
+		}
+	}
+}
+
+func TestContextUseUnknown(t *testing.T) {
+	path, cleanup := writeTestConfig(t)
+	defer cleanup()
+
+	_, err := runContextCommand(t, path, "use", "nope")
+	if err == nil || !strings.Contains(err.Error(), "prod, staging") {
+		t.Errorf("expected an error listing the contexts, got %v", err)
+	}
+
+	config, _ := LoadConfigFile(path)
+	if config.CurrentContext != "prod" {
+		t.Errorf("expected the current context to be unchanged, got %q", config.CurrentContext)
+	}
+}
+
+func TestContextShowMasksSecrets(t *testing.T) {
+	path, cleanup := writeTestConfig(t)
+	defer cleanup()
+
+	// Without argument, the current context is shown
+	out, err := runContextCommand(t, path, "show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "/prod/services") {
+		t.Errorf("expected the settings of prod :\n%s", out)
+	}
+	if strings.Contains(out, "s3cr3t-k3y") {
+		t.Errorf("expected the secret key to be masked :\n%s", out)
+	}
+	if !strings.Contains(out, "********") {
+		t.Errorf("expected a masked value :\n%s", out)
+	}
+
+	if _, err := runContextCommand(t, path, "show", "nope"); err == nil {
+		t.Error("expected an error for an unknown context")
+	}
+}
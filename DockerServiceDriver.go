@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDockerHost  = "unix:///var/run/docker.sock"
+	DefaultDockerLabel = "io.arken.unit"
+)
+
+// DockerServiceDriver starts, stops and pauses the container of a service
+// with the Docker Engine API. The container is the one whose Label is the
+// unit name of the service.
+type DockerServiceDriver struct {
+	// Label is the container label holding the unit name
+	Label string
+	// PassivateMode is pause, or stop to stop passivated containers
+	PassivateMode string
+	// Expected, if set, also writes the expected status in etcd
+	Expected *EtcdServiceDriver
+
+	client  *http.Client
+	baseURL string
+}
+
+var _ drivers.ServiceDriver = (*DockerServiceDriver)(nil)
+
+// NewDockerServiceDriver creates a driver for the Docker daemon listening on
+// host : unix:///path/to/socket, tcp://host:port or an http(s) URL.
+func NewDockerServiceDriver(host string) (*DockerServiceDriver, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Docker host %s : %v", host, err)
+	}
+
+	d := &DockerServiceDriver{
+		Label:         DefaultDockerLabel,
+		PassivateMode: "pause",
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		dialer := &net.Dialer{Timeout: 30 * time.Second}
+		d.client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}}
+		d.baseURL = "http://docker"
+	case "tcp":
+		d.client = &http.Client{}
+		d.baseURL = "http://" + u.Host
+	case "http", "https":
+		d.client = &http.Client{}
+		d.baseURL = strings.TrimSuffix(host, "/")
+	default:
+		return nil, fmt.Errorf("Invalid Docker host %s, expected unix://, tcp://, http:// or https://", host)
+	}
+	return d, nil
+}
+
+func (d *DockerServiceDriver) Start(s *Service) (*Service, error) {
+	container, err := d.findContainer(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if container.State == "paused" {
+		err = d.post("/containers/" + container.Id + "/unpause")
+	} else {
+		err = d.post("/containers/" + container.Id + "/start")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.setExpected(s, STARTED_STATUS)
+}
+
+func (d *DockerServiceDriver) Stop(s *Service) (*Service, error) {
+	container, err := d.findContainer(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.post("/containers/" + container.Id + "/stop"); err != nil {
+		return nil, err
+	}
+	return d.setExpected(s, STOPPED_STATUS)
+}
+
+func (d *DockerServiceDriver) Passivate(s *Service) (*Service, error) {
+	container, err := d.findContainer(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// A container that is not running is already passivated
+	switch {
+	case d.PassivateMode == "stop":
+		err = d.post("/containers/" + container.Id + "/stop")
+	case container.State == "running":
+		err = d.post("/containers/" + container.Id + "/pause")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.setExpected(s, PASSIVATED_STATUS)
+}
+
+func (d *DockerServiceDriver) setExpected(s *Service, expected string) (*Service, error) {
+	if d.Expected == nil {
+		return s, nil
+	}
+	return d.Expected.setExpected(s, expected)
+}
+
+type dockerContainer struct {
+	Id    string
+	State string
+}
+
+// findContainer returns the only container labelled with the unit name of
+// the service.
+func (d *DockerServiceDriver) findContainer(s *Service) (*dockerContainer, error) {
+	if s.UnitName == "" {
+		return nil, fmt.Errorf("Service %s/%s has no unit name to find its container", s.Name, s.Index)
+	}
+
+	filters, err := json.Marshal(map[string][]string{"label": {d.Label + "=" + s.UnitName}})
+	if err != nil {
+		return nil, err
+	}
+
+	containers := []*dockerContainer{}
+	if err := d.get("/containers/json?all=1&filters="+url.QueryEscape(string(filters)), &containers); err != nil {
+		return nil, err
+	}
+
+	switch len(containers) {
+	case 0:
+		return nil, fmt.Errorf("No container labelled %s=%s", d.Label, s.UnitName)
+	case 1:
+		return containers[0], nil
+	default:
+		return nil, fmt.Errorf("%d containers labelled %s=%s, expected one", len(containers), d.Label, s.UnitName)
+	}
+}
+
+// Ping checks that the Docker daemon answers.
+func (d *DockerServiceDriver) Ping() error {
+	return d.do("GET", "/_ping", nil)
+}
+
+func (d *DockerServiceDriver) get(path string, v interface{}) error {
+	return d.do("GET", path, v)
+}
+
+func (d *DockerServiceDriver) post(path string) error {
+	return d.do("POST", path, nil)
+}
+
+func (d *DockerServiceDriver) do(method, path string, v interface{}) error {
+	req, err := http.NewRequest(method, d.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	client := *d.client
+	client.Timeout = time.Minute
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// 304 means the container is already started or stopped
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		message := struct{ Message string }{}
+		if json.Unmarshal(body, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(body))
+		}
+		err := fmt.Errorf("Docker %s %s answered %d : %s", method, strings.SplitN(path, "?", 2)[0], resp.StatusCode, message.Message)
+		if resp.StatusCode >= 500 {
+			return &TransientError{err}
+		}
+		return err
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			return errors.New("Invalid answer from Docker : " + err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// dockerStub speaks the Docker endpoints used by the driver. Containers are
+// listed by the value of their io.arken.unit label.
+type dockerStub struct {
+	lock       sync.Mutex
+	containers map[string][]*dockerContainer
+	// replies overrides the status code answered on a path
+	replies map[string]int
+	calls   []string
+}
+
+func newDockerStub(t *testing.T) (*dockerStub, *DockerServiceDriver, func()) {
+	stub := &dockerStub{containers: map[string][]*dockerContainer{}, replies: map[string]int{}}
+	server := httptest.NewServer(stub)
+
+	driver, err := NewDockerServiceDriver(strings.Replace(server.URL, "http://", "tcp://", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stub, driver, server.Close
+}
+
+func (ds *dockerStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	ds.calls = append(ds.calls, r.Method+" "+r.URL.Path)
+
+	if code, ok := ds.replies[r.URL.Path]; ok {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"message":"stub answered %d"}`, code)
+		return
+	}
+
+	if r.Method == "GET" && r.URL.Path == "/containers/json" {
+		filters := map[string][]string{}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil || len(filters["label"]) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		containers := ds.containers[strings.TrimPrefix(filters["label"][0], DefaultDockerLabel+"=")]
+		if containers == nil {
+			containers = []*dockerContainer{}
+		}
+		json.NewEncoder(w).Encode(containers)
+		return
+	}
+
+	if r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/containers/") {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (ds *dockerStub) lastCall() string {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	if len(ds.calls) == 0 {
+		return ""
+	}
+	return ds.calls[len(ds.calls)-1]
+}
+
+func dockerService() *Service {
+	return &Service{Name: "nxio_000001", Index: "1", UnitName: "nxio_000001@1.service"}
+}
+
+func TestDockerDriverOperations(t *testing.T) {
+	cases := []struct {
+		state     string
+		operation func(d *DockerServiceDriver) ServiceAction
+		expected  string
+	}{
+		{"exited", func(d *DockerServiceDriver) ServiceAction { return d.Start }, "POST /containers/c1/start"},
+		{"paused", func(d *DockerServiceDriver) ServiceAction { return d.Start }, "POST /containers/c1/unpause"},
+		{"running", func(d *DockerServiceDriver) ServiceAction { return d.Stop }, "POST /containers/c1/stop"},
+		{"running", func(d *DockerServiceDriver) ServiceAction { return d.Passivate }, "POST /containers/c1/pause"},
+	}
+
+	for _, c := range cases {
+		stub, driver, stop := newDockerStub(t)
+		stub.containers["nxio_000001@1.service"] = []*dockerContainer{{Id: "c1", State: c.state}}
+
+		if _, err := c.operation(driver)(dockerService()); err != nil {
+			t.Errorf("%s : unexpected error %v", c.expected, err)
+		}
+		if call := stub.lastCall(); call != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, call)
+		}
+		stop()
+	}
+}
+
+func TestDockerDriverPassivateWithStop(t *testing.T) {
+	stub, driver, stop := newDockerStub(t)
+	defer stop()
+	stub.containers["nxio_000001@1.service"] = []*dockerContainer{{Id: "c1", State: "running"}}
+	driver.PassivateMode = "stop"
+
+	if _, err := driver.Passivate(dockerService()); err != nil {
+		t.Fatal(err)
+	}
+	if call := stub.lastCall(); call != "POST /containers/c1/stop" {
+		t.Errorf("expected a stop, got %s", call)
+	}
+}
+
+func TestDockerDriverAlreadyInState(t *testing.T) {
+	stub, driver, stop := newDockerStub(t)
+	defer stop()
+	stub.containers["nxio_000001@1.service"] = []*dockerContainer{{Id: "c1", State: "running"}}
+	stub.replies["/containers/c1/start"] = http.StatusNotModified
+
+	if _, err := driver.Start(dockerService()); err != nil {
+		t.Errorf("304 must not be an error, got %v", err)
+	}
+}
+
+func TestDockerDriverServerErrorIsTransient(t *testing.T) {
+	stub, driver, stop := newDockerStub(t)
+	defer stop()
+	stub.containers["nxio_000001@1.service"] = []*dockerContainer{{Id: "c1", State: "running"}}
+	stub.replies["/containers/c1/stop"] = http.StatusInternalServerError
+
+	_, err := driver.Stop(dockerService())
+	if _, ok := err.(*TransientError); !ok {
+		t.Fatalf("expected a TransientError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "stub answered 500") {
+		t.Errorf("the Docker message is missing from %q", err)
+	}
+}
+
+func TestDockerDriverContainerLookup(t *testing.T) {
+	stub, driver, stop := newDockerStub(t)
+	defer stop()
+
+	_, err := driver.Start(dockerService())
+	if err == nil || !strings.Contains(err.Error(), "No container labelled io.arken.unit=nxio_000001@1.service") {
+		t.Errorf("expected a no container error, got %v", err)
+	}
+
+	stub.containers["nxio_000001@1.service"] = []*dockerContainer{{Id: "c1"}, {Id: "c2"}}
+	_, err = driver.Start(dockerService())
+	if err == nil || !strings.Contains(err.Error(), "2 containers labelled") {
+		t.Errorf("expected a multiple containers error, got %v", err)
+	}
+
+	for _, call := range stub.calls {
+		if strings.HasPrefix(call, "POST") {
+			t.Errorf("no container must be started, got %s", call)
+		}
+	}
+}
+
+func TestDockerDriverUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &dockerStub{containers: map[string][]*dockerContainer{}, replies: map[string]int{"/_ping": http.StatusOK}}
+	server := &httptest.Server{Listener: listener, Config: &http.Server{Handler: stub}}
+	server.Start()
+	defer server.Close()
+
+	driver, err := NewDockerServiceDriver("unix://" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Ping(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if call := stub.lastCall(); call != "GET /_ping" {
+		t.Errorf("expected the ping to go through the socket, got %q", call)
+	}
+
+	server.Close()
+	if err := driver.Ping(); err == nil {
+		t.Error("expected an error once the daemon is gone")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/codegangsta/cli"
 	"github.com/coreos/go-etcd/etcd"
 	"os"
+	"sort"
 	"strings"
 	"text/tabwriter"
 )
@@ -32,6 +33,26 @@ func (dc *DomainCommand) getDomain() (*Domain, error) {
 
 func (dc *DomainCommand) List(stop chan interface{}) error {
 
+	output := dc.Cli.String("output")
+	if err := checkOutputFormat(output); err != nil {
+		return err
+	}
+
+	if isStructuredOutput(output) {
+		hosts := make([]string, 0, len(dc.Watcher.Domains))
+		for host := range dc.Watcher.Domains {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+
+		domains := make([]*DomainOutput, 0, len(hosts))
+		for _, host := range hosts {
+			domain := dc.Watcher.Domains[host]
+			domains = append(domains, &DomainOutput{Name: host, Type: domain.Typ, Value: domain.Value})
+		}
+		return writeOutput(output, domains, os.Stdout)
+	}
+
 	w := new(tabwriter.Writer)
 	w.Init(os.Stdout, 0, 8, 2, '\t', 0)
 	fmt.Fprintln(w, "Host\tTyp\tValue")
@@ -52,15 +73,34 @@ func (dc *DomainCommand) List(stop chan interface{}) error {
 }
 
 func (dc *DomainCommand) Cat(stop chan interface{}) error {
+	output := dc.Cli.String("output")
+	if err := checkOutputFormat(output); err != nil {
+		return err
+	}
+
 	domain, err := dc.getDomain()
 	if err != nil {
 		return err
 	}
 
+	var cluster *ServiceCluster
 	if domain.Typ == "service" {
 		path := dc.Cli.GlobalString("serviceDir") + "/" + domain.Value
-		service, _ := GetServiceClusterFromPath(path, dc.Client)
-		renderService(service, "", os.Stdout)
+		if cluster, err = GetServiceClusterFromPath(path, dc.Client); err != nil {
+			return err
+		}
+	}
+
+	if isStructuredOutput(output) {
+		out := &DomainOutput{Name: dc.Cli.Args()[0], Type: domain.Typ, Value: domain.Value}
+		if cluster != nil {
+			out.Services = NewServiceOutputs(cluster.GetInstances())
+		}
+		return writeOutput(output, out, os.Stdout)
+	}
+
+	if cluster != nil {
+		renderService(cluster, "", os.Stdout)
 	} else {
 		fmt.Printf("Redirecting to : %s", domain.Value)
 	}
@@ -82,48 +122,31 @@ func (dc *DomainCommand) getAssociatedCluster() (*ServiceCluster, error) {
 }
 
 func (dc *DomainCommand) Start(stop chan interface{}) error {
+	return dc.act("start", dc.ServiceDriver.Start)
+}
 
-	cluster, err := dc.getAssociatedCluster()
-	if err != nil {
-		return err
-	}
-
-	for _, service := range cluster.GetInstances() {
-		service, err = dc.ServiceDriver.Start(service)
-		if err != nil {
-			break
-		}
-	}
-	return nil
+func (dc *DomainCommand) Stop(stop chan interface{}) error {
+	return dc.act("stop", dc.ServiceDriver.Stop)
+}
 
+func (dc *DomainCommand) Passivate(stop chan interface{}) error {
+	return dc.act("passivate", dc.ServiceDriver.Passivate)
 }
 
-func (dc *DomainCommand) Stop(stop chan interface{}) error {
+func (dc *DomainCommand) Restart(stop chan interface{}) error {
 	cluster, err := dc.getAssociatedCluster()
 	if err != nil {
 		return err
 	}
 
-	for _, service := range cluster.GetInstances() {
-		service, err = dc.ServiceDriver.Stop(service)
-		if err != nil {
-			break
-		}
-	}
-	return nil
+	return runRestart(dc.Cli, dc.Client, dc.ServiceDriver, cluster.GetInstances())
 }
 
-func (dc *DomainCommand) Passivate(stop chan interface{}) error {
+func (dc *DomainCommand) act(action string, serviceAction ServiceAction) error {
 	cluster, err := dc.getAssociatedCluster()
 	if err != nil {
 		return err
 	}
 
-	for _, service := range cluster.GetInstances() {
-		service, err = dc.ServiceDriver.Passivate(service)
-		if err != nil {
-			break
-		}
-	}
-	return nil
+	return runAction(dc.Cli, action, cluster.GetInstances(), 1, waitFor(dc.Cli, dc.Client, action, serviceAction))
 }
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/arkenio/goarken/drivers"
+	"github.com/codegangsta/cli"
+	"github.com/coreos/go-etcd/etcd"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DriverConfig holds the name and settings of the service driver.
+type DriverConfig struct {
+	Name       string
+	ServiceDir string
+	// ExecPath is the plugin of the exec driver, given as exec:<path>
+	ExecPath         string
+	RancherEndpoint  string
+	RancherAccessKey string
+	RancherSecretKey string
+	DockerHost       string
+	DockerLabel      string
+	DockerPassivate  string
+	KubeConfig       string
+	KubeContext      string
+	KubeNamespace    string
+	KubeDeployment   string
+	KubeReplicas     int
+	// Timeout bounds each driver call, it is also the deadline of the exec
+	// driver plugin
+	Timeout time.Duration
+}
+
+func NewDriverConfigFromCli(c *cli.Context) *DriverConfig {
+	config := &DriverConfig{
+		Name:             c.GlobalString("driver"),
+		ServiceDir:       c.GlobalString("serviceDir"),
+		RancherEndpoint:  c.GlobalString("rancherEndpoint"),
+		RancherAccessKey: c.GlobalString("rancherAccessKey"),
+		RancherSecretKey: c.GlobalString("rancherSecretKey"),
+		DockerHost:       c.GlobalString("dockerHost"),
+		DockerLabel:      c.GlobalString("dockerLabel"),
+		DockerPassivate:  c.GlobalString("dockerPassivate"),
+		KubeConfig:       c.GlobalString("kubeconfig"),
+		KubeContext:      c.GlobalString("kubeContext"),
+		KubeNamespace:    c.GlobalString("kubeNamespace"),
+		KubeDeployment:   c.GlobalString("kubeDeployment"),
+		KubeReplicas:     c.GlobalInt("kubeReplicas"),
+		Timeout:          time.Duration(c.GlobalInt("driverTimeout")) * time.Second,
+	}
+	if strings.HasPrefix(config.Name, "exec:") {
+		config.Name, config.ExecPath = "exec", strings.TrimPrefix(config.Name, "exec:")
+	}
+	return config
+}
+
+// Validate checks that the driver is known and that its required settings
+// are given.
+func (dc *DriverConfig) Validate() error {
+	switch dc.Name {
+	case "fleet", "etcd":
+		return nil
+	case "rancher":
+		return dc.validateRancher()
+	case "exec":
+		return dc.validateExec()
+	case "docker":
+		_, err := dc.newDockerDriver(nil)
+		return err
+	case "kubernetes":
+		_, err := dc.newKubernetesDriver(nil)
+		return err
+	default:
+		return fmt.Errorf("Unknown driver %q, use fleet, rancher, etcd, docker, kubernetes or exec:<plugin path>", dc.Name)
+	}
+}
+
+func (dc *DriverConfig) validateRancher() error {
+	missing := []string{}
+	if dc.RancherEndpoint == "" {
+		missing = append(missing, "--rancherEndpoint (RANCHER_ENDPOINT)")
+	}
+	if dc.RancherAccessKey == "" {
+		missing = append(missing, "--rancherAccessKey (RANCHER_ACCESSKEY)")
+	}
+	if dc.RancherSecretKey == "" {
+		missing = append(missing, "--rancherSecretKey (RANCHER_SECRETKEY)")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("The rancher driver needs %s", strings.Join(missing, ", "))
+	}
+
+	endpoint, err := url.Parse(dc.RancherEndpoint)
+	if err != nil {
+		return fmt.Errorf("Invalid Rancher endpoint %s : %v", dc.RancherEndpoint, err)
+	}
+	if (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return fmt.Errorf("Invalid Rancher endpoint %s, expected an http or https URL such as http://rancher:8080/v1", dc.RancherEndpoint)
+	}
+	return nil
+}
+
+func (dc *DriverConfig) validateExec() error {
+	if dc.ExecPath == "" {
+		return errors.New("The exec driver needs the path of the plugin, e.g. --driver exec:/usr/local/bin/my-driver")
+	}
+	info, err := os.Stat(dc.ExecPath)
+	if err != nil {
+		return fmt.Errorf("Invalid exec driver plugin : %v", err)
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return fmt.Errorf("Invalid exec driver plugin : %s is not executable", dc.ExecPath)
+	}
+	return nil
+}
+
+// newDockerDriver creates the docker driver. The expected status is also
+// written in etcd when a client is given.
+func (dc *DriverConfig) newDockerDriver(etcdClient *etcd.Client) (*DockerServiceDriver, error) {
+	if dc.DockerPassivate != "pause" && dc.DockerPassivate != "stop" {
+		return nil, fmt.Errorf("Invalid --dockerPassivate %q, use pause or stop", dc.DockerPassivate)
+	}
+	if dc.DockerLabel == "" {
+		return nil, errors.New("The docker driver needs --dockerLabel to find the containers")
+	}
+
+	driver, err := NewDockerServiceDriver(dc.DockerHost)
+	if err != nil {
+		return nil, err
+	}
+	driver.Label = dc.DockerLabel
+	driver.PassivateMode = dc.DockerPassivate
+	if etcdClient != nil {
+		driver.Expected = NewEtcdServiceDriver(etcdClient, dc.ServiceDir)
+	}
+	return driver, nil
+}
+
+// newKubernetesDriver creates the kubernetes driver. The expected status is
+// also written in etcd when a client is given.
+func (dc *DriverConfig) newKubernetesDriver(etcdClient *etcd.Client) (*KubernetesServiceDriver, error) {
+	config, err := NewKubernetesConfig(dc.KubeConfig, dc.KubeContext)
+	if err != nil {
+		return nil, err
+	}
+	if dc.KubeNamespace != "" {
+		config.Namespace = dc.KubeNamespace
+	}
+
+	driver, err := NewKubernetesServiceDriver(config, dc.KubeDeployment, dc.KubeReplicas)
+	if err != nil {
+		return nil, err
+	}
+	if etcdClient != nil {
+		driver.Expected = NewEtcdServiceDriver(etcdClient, dc.ServiceDir)
+	}
+	return driver, nil
+}
+
+// NewDriver validates the settings and creates the driver.
+func (dc *DriverConfig) NewDriver(etcdClient *etcd.Client) (drivers.ServiceDriver, error) {
+	if err := dc.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch dc.Name {
+	case "rancher":
+		return drivers.NewRancherServiceDriver(etcdClient,
+			dc.RancherEndpoint, dc.RancherAccessKey, dc.RancherSecretKey), nil
+	case "etcd":
+		return NewEtcdServiceDriver(etcdClient, dc.ServiceDir), nil
+	case "exec":
+		driver := NewExecServiceDriver(dc.ExecPath)
+		if dc.Timeout > 0 {
+			driver.Timeout = dc.Timeout
+		}
+		return driver, nil
+	case "docker":
+		return dc.newDockerDriver(etcdClient)
+	case "kubernetes":
+		return dc.newKubernetesDriver(etcdClient)
+	default:
+		return drivers.NewFleetServiceDriver(etcdClient), nil
+	}
+}
+
+// DriverInfoCommand prints the driver settings, and checks that the driver
+// is able to reach etcd and its backend.
+type DriverInfoCommand struct {
+	Config *DriverConfig
+	Client *etcd.Client
+	Cli    *cli.Context
+	Out    io.Writer
+}
+
+func (di *DriverInfoCommand) Run(stop chan interface{}) error {
+	w := new(tabwriter.Writer)
+	w.Init(di.Out, 0, 8, 2, '\t', 0)
+	fmt.Fprintf(w, "Driver\t%s\n", di.Config.Name)
+	if di.Config.Name == "exec" {
+		fmt.Fprintf(w, "Plugin\t%s (protocol version %d)\n", di.Config.ExecPath, ExecDriverProtocolVersion)
+	}
+	if di.Config.Name == "rancher" {
+		fmt.Fprintf(w, "Rancher endpoint\t%s\n", di.Config.RancherEndpoint)
+		fmt.Fprintf(w, "Rancher access key\t%s\n", di.Config.RancherAccessKey)
+		fmt.Fprintf(w, "Rancher secret key\t%s\n", maskSecret(di.Config.RancherSecretKey))
+	}
+	if di.Config.Name == "docker" {
+		fmt.Fprintf(w, "Docker host\t%s\n", di.Config.DockerHost)
+		fmt.Fprintf(w, "Container label\t%s\n", di.Config.DockerLabel)
+		fmt.Fprintf(w, "Passivation\t%s\n", di.Config.DockerPassivate)
+	}
+	if di.Config.Name == "kubernetes" {
+		if driver, err := di.Config.newKubernetesDriver(nil); err == nil {
+			fmt.Fprintf(w, "API server\t%s\n", driver.Config.Server)
+			fmt.Fprintf(w, "Namespace\t%s\n", driver.Config.Namespace)
+		}
+		fmt.Fprintf(w, "Deployment\t%s\n", di.Config.KubeDeployment)
+		fmt.Fprintf(w, "Replicas\t%d\n", di.Config.KubeReplicas)
+	}
+	fmt.Fprintln(w)
+
+	failed := 0
+	check := func(name string, err error) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "%s\tfailed : %v\n", name, err)
+		} else {
+			fmt.Fprintf(w, "%s\tok\n", name)
+		}
+	}
+
+	err := di.Config.Validate()
+	check("Configuration", err)
+	check("etcd", di.checkEtcd())
+	if err == nil && di.Config.Name == "rancher" {
+		check("Rancher", di.checkRancher())
+	}
+	if err == nil && di.Config.Name == "docker" {
+		driver, _ := di.Config.newDockerDriver(nil)
+		check("Docker", driver.Ping())
+	}
+	if err == nil && di.Config.Name == "kubernetes" {
+		driver, _ := di.Config.newKubernetesDriver(nil)
+		check("Kubernetes", driver.Ping())
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+func (di *DriverInfoCommand) checkEtcd() error {
+	if !di.Client.SyncCluster() {
+		return fmt.Errorf("unable to sync with etcd cluster at %s", di.Cli.GlobalString("etcdAddress"))
+	}
+	return nil
+}
+
+// checkRancher calls the Rancher API with the credentials.
+func (di *DriverInfoCommand) checkRancher() error {
+	req, err := http.NewRequest("GET", di.Config.RancherEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(di.Config.RancherAccessKey, di.Config.RancherSecretKey)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return errors.New("credentials rejected by Rancher")
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("Rancher answered %s", resp.Status)
+	}
+	return nil
+}
+
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"github.com/codegangsta/cli"
+	"os"
+	"strings"
+	"testing"
+)
+
+// setenv sets environment variables, and returns a function restoring them.
+func setenv(values map[string]string) func() {
+	previous := map[string]string{}
+	for key, value := range values {
+		previous[key] = os.Getenv(key)
+		os.Setenv(key, value)
+	}
+	return func() {
+		for key, value := range previous {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+func TestDriverConfigValidate(t *testing.T) {
+	rancher := func(endpoint, accessKey, secretKey string) *DriverConfig {
+		return &DriverConfig{Name: "rancher", RancherEndpoint: endpoint, RancherAccessKey: accessKey, RancherSecretKey: secretKey}
+	}
+
+	tests := []struct {
+		config  *DriverConfig
+		message string
+	}{
+		{&DriverConfig{Name: "fleet"}, ""},
+		{rancher("http://rancher:8080/v1", "ak", "sk"), ""},
+		{rancher("https://rancher.nuxeo.io/v1", "ak", "sk"), ""},
+		{rancher("", "", ""), "The rancher driver needs --rancherEndpoint (RANCHER_ENDPOINT), " +
+			"--rancherAccessKey (RANCHER_ACCESSKEY), --rancherSecretKey (RANCHER_SECRETKEY)"},
+		{rancher("http://rancher:8080/v1", "ak", ""), "The rancher driver needs --rancherSecretKey (RANCHER_SECRETKEY)"},
+		{rancher("rancher:8080", "ak", "sk"), "Invalid Rancher endpoint rancher:8080, expected an http or https URL"},
+		{rancher("ftp://rancher/v1", "ak", "sk"), "Invalid Rancher endpoint ftp://rancher/v1, expected an http or https URL"},
+		{rancher("http://", "ak", "sk"), "Invalid Rancher endpoint http://, expected an http or https URL"},
+		{rancher("http://rancher:port/v1", "ak", "sk"), "Invalid Rancher endpoint http://rancher:port/v1 : "},
+		{&DriverConfig{Name: "swarm"}, `Unknown driver "swarm"`},
+		{&DriverConfig{}, `Unknown driver ""`},
+	}
+
+	for _, test := range tests {
+		err := test.config.Validate()
+		if test.message == "" {
+			if err != nil {
+				t.Errorf("%+v : unexpected error %v", test.config, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.message) {
+			t.Errorf("%+v : expected %q, got %v", test.config, test.message, err)
+		}
+	}
+}
+
+// driverConfigFromArgs returns the driver settings read from the global
+// flags and their environment variables.
+func driverConfigFromArgs(t *testing.T, args ...string) *DriverConfig {
+	var config *DriverConfig
+	app := cli.NewApp()
+	app.Flags = GetGlobalFlags()
+	app.Commands = []cli.Command{{
+		Name: "info",
+		Action: func(c *cli.Context) {
+			config = NewDriverConfigFromCli(c)
+		},
+	}}
+	if err := app.Run(append(append([]string{progname}, args...), "info")); err != nil {
+		t.Fatal(err)
+	}
+	if config == nil {
+		t.Fatalf("%v : the command did not run", args)
+	}
+	return config
+}
+
+// The Rancher endpoint used to be read from an undefined rancherHost flag,
+// and was always empty.
+func TestRancherEndpointFromCli(t *testing.T) {
+	defer setenv(map[string]string{
+		"RANCHER_ENDPOINT":  "",
+		"RANCHER_ACCESSKEY": "",
+		"RANCHER_SECRETKEY": "",
+	})()
+
+	config := driverConfigFromArgs(t, "--driver", "rancher",
+		"--rancherEndpoint", "http://rancher:8080/v1", "--rancherAccessKey", "ak", "--rancherSecretKey", "sk")
+	if config.RancherEndpoint != "http://rancher:8080/v1" {
+		t.Errorf("expected the endpoint of --rancherEndpoint, got %q", config.RancherEndpoint)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	os.Setenv("RANCHER_ENDPOINT", "https://rancher.nuxeo.io/v1")
+	os.Setenv("RANCHER_ACCESSKEY", "ak")
+	os.Setenv("RANCHER_SECRETKEY", "sk")
+	config = driverConfigFromArgs(t, "--driver", "rancher")
+	if config.RancherEndpoint != "https://rancher.nuxeo.io/v1" {
+		t.Errorf("expected the endpoint of RANCHER_ENDPOINT, got %q", config.RancherEndpoint)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
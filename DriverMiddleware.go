@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/golang/glog"
+	"net"
+	"sync"
+	"time"
+)
+
+// DriverMiddleware decorates the calls made to a driver.
+type DriverMiddleware func(next drivers.ServiceDriver) drivers.ServiceDriver
+
+// ChainDriver decorates the driver with the middlewares. The first
+// middleware is the outermost one.
+func ChainDriver(driver drivers.ServiceDriver, middlewares ...DriverMiddleware) drivers.ServiceDriver {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		driver = middlewares[i](driver)
+	}
+	return driver
+}
+
+// wrappedDriver calls wrap around each operation of the next driver.
+type wrappedDriver struct {
+	next drivers.ServiceDriver
+	wrap func(operation string, s *Service, call ServiceAction) (*Service, error)
+}
+
+func (d *wrappedDriver) Start(s *Service) (*Service, error) {
+	return d.wrap("start", s, d.next.Start)
+}
+
+func (d *wrappedDriver) Stop(s *Service) (*Service, error) {
+	return d.wrap("stop", s, d.next.Stop)
+}
+
+func (d *wrappedDriver) Passivate(s *Service) (*Service, error) {
+	return d.wrap("passivate", s, d.next.Passivate)
+}
+
+// TransientError is returned by drivers for failures that may not happen
+// again, such as an unavailable backend. These calls are retried.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+// TimeoutError is returned by WithTimeout. It is not transient : the call
+// may still be running, retrying it would send it twice.
+type TimeoutError struct {
+	Operation string
+	Service   *Service
+	Timeout   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s of %s/%s timed out after %v", e.Operation, e.Service.Name, e.Service.Index, e.Timeout)
+}
+
+// isTransient returns true for errors worth retrying : transient driver
+// errors, network errors and unreachable etcd. Timeouts are not retried as
+// the backend may have received the call.
+func isTransient(err error) bool {
+	switch e := err.(type) {
+	case *TransientError:
+		return true
+	case net.Error:
+		return !e.Timeout()
+	case *etcd.EtcdError:
+		return e.ErrorCode == etcd.ErrCodeEtcdNotReachable
+	}
+	return false
+}
+
+// WithTimeout fails the calls that take more than timeout with a
+// TimeoutError. The call itself is not cancelled, the drivers offer no way to
+// do it.
+func WithTimeout(timeout time.Duration) DriverMiddleware {
+	return func(next drivers.ServiceDriver) drivers.ServiceDriver {
+		return &wrappedDriver{next: next, wrap: func(operation string, s *Service, call ServiceAction) (*Service, error) {
+			type result struct {
+				service *Service
+				err     error
+			}
+			done := make(chan result, 1)
+			go func() {
+				service, err := call(s)
+				done <- result{service, err}
+			}()
+
+			select {
+			case r := <-done:
+				return r.service, r.err
+			case <-time.After(timeout):
+				return nil, &TimeoutError{Operation: operation, Service: s, Timeout: timeout}
+			}
+		}}
+	}
+}
+
+// WithRetry retries the calls failing with a transient error, at most
+// retries times. The first retry waits backoff, which doubles at each retry.
+func WithRetry(retries int, backoff time.Duration) DriverMiddleware {
+	return func(next drivers.ServiceDriver) drivers.ServiceDriver {
+		return &wrappedDriver{next: next, wrap: func(operation string, s *Service, call ServiceAction) (*Service, error) {
+			wait := backoff
+			for attempt := 0; ; attempt++ {
+				service, err := call(s)
+				if err == nil || attempt >= retries || !isTransient(err) {
+					return service, err
+				}
+				glog.Warningf("%s of %s/%s failed, retrying in %v : %v", operation, s.Name, s.Index, wait, err)
+				time.Sleep(wait)
+				wait *= 2
+			}
+		}}
+	}
+}
+
+// WithRateLimit spaces the calls so that at most perMinute calls are made
+// each minute, whatever the number of concurrent callers.
+func WithRateLimit(perMinute int) DriverMiddleware {
+	limiter := &rateLimiter{interval: time.Minute / time.Duration(perMinute)}
+	return func(next drivers.ServiceDriver) drivers.ServiceDriver {
+		return &wrappedDriver{next: next, wrap: func(operation string, s *Service, call ServiceAction) (*Service, error) {
+			limiter.wait()
+			return call(s)
+		}}
+	}
+}
+
+type rateLimiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (rl *rateLimiter) wait() {
+	rl.lock.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	delay := rl.next.Sub(now)
+	rl.next = rl.next.Add(rl.interval)
+	rl.lock.Unlock()
+
+	time.Sleep(delay)
+}
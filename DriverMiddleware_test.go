@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	. "github.com/arkenio/goarken"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientErrors(t *testing.T) {
+	d := &countingDriver{failures: 2, err: &TransientError{errors.New("503")}}
+	driver := ChainDriver(d, WithRetry(2, time.Millisecond))
+
+	if _, err := driver.Start(&Service{Name: "a", Index: "1"}); err != nil {
+		t.Fatalf("Start failed : %v", err)
+	}
+	if d.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", d.calls)
+	}
+}
+
+func TestRetrySkipsPermanentErrors(t *testing.T) {
+	d := &countingDriver{failures: 1, err: errors.New("no such unit")}
+	driver := ChainDriver(d, WithRetry(2, time.Millisecond))
+
+	if _, err := driver.Stop(&Service{Name: "a", Index: "1"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if d.calls != 1 {
+		t.Errorf("expected 1 call, got %d", d.calls)
+	}
+}
+
+func TestTimeoutIsNotRetried(t *testing.T) {
+	d := &countingDriver{delay: 50 * time.Millisecond}
+	driver := ChainDriver(d, WithRetry(2, time.Millisecond), WithTimeout(10*time.Millisecond))
+
+	_, err := driver.Start(&Service{Name: "a", Index: "1"})
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Fatalf("expected a TimeoutError, got %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if calls := atomic.LoadInt32(&d.calls); calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	d := &countingDriver{}
+	// One call every 100ms
+	driver := ChainDriver(d, WithRateLimit(600))
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			driver.Start(&Service{Name: "a", Index: "1"})
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("expected 4 calls to be spaced by 100ms, all done in %v", elapsed)
+	}
+	if d.calls != 4 {
+		t.Errorf("expected 4 calls, got %d", d.calls)
+	}
+}
+
+func TestRateLimiterDoesNotAccumulateIdleTime(t *testing.T) {
+	rl := &rateLimiter{interval: 100 * time.Millisecond}
+	rl.wait()
+	time.Sleep(250 * time.Millisecond)
+
+	// Being idle does not allow a burst of calls afterwards
+	start := time.Now()
+	rl.wait()
+	rl.wait()
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected the second call to wait, both done in %v", elapsed)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
+	"github.com/coreos/go-etcd/etcd"
+	"path"
+)
+
+// EtcdDriverClient is the part of the etcd client used by EtcdServiceDriver.
+type EtcdDriverClient interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key string, value string, ttl uint64) (*etcd.Response, error)
+}
+
+// EtcdServiceDriver only writes the expected status of the services in etcd,
+// and lets an external agent reconcile their current status.
+type EtcdServiceDriver struct {
+	Client     EtcdDriverClient
+	ServiceDir string
+}
+
+func NewEtcdServiceDriver(client EtcdDriverClient, serviceDir string) *EtcdServiceDriver {
+	return &EtcdServiceDriver{Client: client, ServiceDir: serviceDir}
+}
+
+var _ drivers.ServiceDriver = (*EtcdServiceDriver)(nil)
+
+func (d *EtcdServiceDriver) Start(s *Service) (*Service, error) {
+	return d.setExpected(s, STARTED_STATUS)
+}
+
+func (d *EtcdServiceDriver) Stop(s *Service) (*Service, error) {
+	return d.setExpected(s, STOPPED_STATUS)
+}
+
+func (d *EtcdServiceDriver) Passivate(s *Service) (*Service, error) {
+	return d.setExpected(s, PASSIVATED_STATUS)
+}
+
+// setExpected writes the expected status of an existing service, and
+// returns the service with this expected status.
+func (d *EtcdServiceDriver) setExpected(s *Service, expected string) (*Service, error) {
+	serviceKey := path.Join(d.ServiceDir, s.Name, s.Index)
+	if _, err := d.Client.Get(serviceKey, false, false); err != nil {
+		if etcdErr, ok := err.(*etcd.EtcdError); ok && etcdErr.ErrorCode == 100 {
+			return nil, fmt.Errorf("Service %s/%s not found in %s", s.Name, s.Index, d.ServiceDir)
+		}
+		return nil, err
+	}
+
+	if _, err := d.Client.Set(path.Join(serviceKey, "status", "expected"), expected, 0); err != nil {
+		return nil, err
+	}
+
+	updated := *s
+	updated.Status = &Status{Service: &updated, Expected: expected}
+	if s.Status != nil {
+		updated.Status.Current = s.Status.Current
+		updated.Status.Alive = s.Status.Alive
+	}
+	return &updated, nil
+}
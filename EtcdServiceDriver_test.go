@@ -0,0 +1,51 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"strings"
+	"testing"
+)
+
+func TestEtcdServiceDriverSetsExpectedStatus(t *testing.T) {
+	client := &fakeEtcd{values: map[string]string{
+		"/arken/units/nxio_000001/1/status/current": STOPPED_STATUS,
+	}}
+	driver := NewEtcdServiceDriver(client, "/arken/units")
+	service := &Service{Name: "nxio_000001", Index: "1", Status: &Status{Current: STOPPED_STATUS}}
+
+	actions := []struct {
+		action   func(*Service) (*Service, error)
+		expected string
+	}{
+		{driver.Start, STARTED_STATUS},
+		{driver.Stop, STOPPED_STATUS},
+		{driver.Passivate, PASSIVATED_STATUS},
+	}
+	for _, a := range actions {
+		updated, err := a.action(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value := client.values["/arken/units/nxio_000001/1/status/expected"]; value != a.expected {
+			t.Errorf("expected %s to be written, got %q", a.expected, value)
+		}
+		if updated.Status.Expected != a.expected || updated.Status.Current != STOPPED_STATUS {
+			t.Errorf("unexpected returned status %+v", updated.Status)
+		}
+	}
+}
+
+func TestEtcdServiceDriverMissingService(t *testing.T) {
+	client := &fakeEtcd{values: map[string]string{
+		"/arken/units/nxio_000001/1/status/current": STOPPED_STATUS,
+	}}
+	driver := NewEtcdServiceDriver(client, "/arken/units")
+
+	_, err := driver.Start(&Service{Name: "nxio_000001", Index: "2"})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if len(client.values) != 1 {
+		t.Errorf("expected nothing to be written, got %v", client.values)
+	}
+}
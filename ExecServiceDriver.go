@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ExecDriverProtocolVersion is the version of the protocol spoken with exec
+// driver plugins. It is sent in every request, and plugins must answer with
+// the same version.
+const ExecDriverProtocolVersion = 1
+
+// DefaultExecDriverTimeout is the time given to a plugin to answer before
+// it is killed.
+const DefaultExecDriverTimeout = 120 * time.Second
+
+// ExecDriverRequest is written as JSON on the standard input of the plugin.
+type ExecDriverRequest struct {
+	Version   int            `json:"version"`
+	Operation string         `json:"operation"`
+	Service   *ServiceOutput `json:"service"`
+}
+
+// ExecDriverResponse is read as JSON on the standard output of the plugin.
+// Error is set if the operation failed, otherwise Status is the new status
+// of the service.
+type ExecDriverResponse struct {
+	Version int           `json:"version"`
+	Status  *StatusOutput `json:"status,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// ExecServiceDriver delegates the operations to an external executable.
+// The plugin is killed if it does not answer within Timeout.
+type ExecServiceDriver struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func NewExecServiceDriver(path string) *ExecServiceDriver {
+	return &ExecServiceDriver{Path: path, Timeout: DefaultExecDriverTimeout}
+}
+
+var _ drivers.ServiceDriver = (*ExecServiceDriver)(nil)
+
+func (d *ExecServiceDriver) Start(s *Service) (*Service, error) {
+	return d.call("start", s)
+}
+
+func (d *ExecServiceDriver) Stop(s *Service) (*Service, error) {
+	return d.call("stop", s)
+}
+
+func (d *ExecServiceDriver) Passivate(s *Service) (*Service, error) {
+	return d.call("passivate", s)
+}
+
+func (d *ExecServiceDriver) call(operation string, s *Service) (*Service, error) {
+	request, err := json.Marshal(&ExecDriverRequest{
+		Version:   ExecDriverProtocolVersion,
+		Operation: operation,
+		Service:   NewServiceOutput(s),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExecDriverTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, d.Path)
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("Plugin %s did not answer to %s of %s/%s within %v",
+			d.Path, operation, s.Name, s.Index, timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("Plugin %s failed : %v : %s", d.Path, err, msg)
+		}
+		return nil, fmt.Errorf("Plugin %s failed : %v", d.Path, err)
+	}
+
+	response := &ExecDriverResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return nil, fmt.Errorf("Invalid response from plugin %s : %v", d.Path, err)
+	}
+	if response.Version != ExecDriverProtocolVersion {
+		return nil, fmt.Errorf("Plugin %s answered with protocol version %d, expected %d",
+			d.Path, response.Version, ExecDriverProtocolVersion)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("%s of %s/%s failed : %s", operation, s.Name, s.Index, response.Error)
+	}
+
+	updated := *s
+	if response.Status != nil {
+		updated.Status = &Status{
+			Service:  &updated,
+			Expected: response.Status.Expected,
+			Current:  response.Status.Current,
+			Alive:    response.Status.Alive,
+		}
+	}
+	return &updated, nil
+}
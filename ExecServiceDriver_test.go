@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecDriverHelperPlugin is not a real test : it is run as the exec
+// driver plugin by the tests below, which set EXEC_DRIVER_TEST_MODE.
+func TestExecDriverHelperPlugin(t *testing.T) {
+	mode := os.Getenv("EXEC_DRIVER_TEST_MODE")
+	if mode == "" {
+		return
+	}
+
+	request := &ExecDriverRequest{}
+	if err := json.NewDecoder(os.Stdin).Decode(request); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid request : %v", err)
+		os.Exit(2)
+	}
+
+	response := &ExecDriverResponse{Version: ExecDriverProtocolVersion}
+	switch mode {
+	case "ok":
+		response.Status = &StatusOutput{Expected: STARTED_STATUS, Current: STARTING_STATUS}
+	case "version":
+		response.Version = ExecDriverProtocolVersion + 1
+	case "error":
+		response.Error = "no such unit " + request.Service.Name
+	case "crash":
+		fmt.Fprint(os.Stderr, "unable to reach the scheduler")
+		os.Exit(1)
+	case "hang":
+		time.Sleep(time.Minute)
+	}
+	json.NewEncoder(os.Stdout).Encode(response)
+	os.Exit(0)
+}
+
+// newHelperPlugin returns an exec driver running the test binary as its
+// plugin, in the given mode.
+func newHelperPlugin(t *testing.T, mode string) (*ExecServiceDriver, func()) {
+	dir, err := ioutil.TempDir("", "exec-driver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "plugin")
+	content := fmt.Sprintf("#!/bin/sh\nEXEC_DRIVER_TEST_MODE=%s exec %q -test.run=TestExecDriverHelperPlugin\n", mode, os.Args[0])
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return NewExecServiceDriver(script), func() { os.RemoveAll(dir) }
+}
+
+func execTestService() *Service {
+	return &Service{Name: "nxio_000001", Index: "1", Status: &Status{Expected: STOPPED_STATUS, Current: STOPPED_STATUS}}
+}
+
+func TestExecDriverSuccess(t *testing.T) {
+	driver, cleanup := newHelperPlugin(t, "ok")
+	defer cleanup()
+
+	updated, err := driver.Start(execTestService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status.Expected != STARTED_STATUS || updated.Status.Current != STARTING_STATUS {
+		t.Errorf("expected the status answered by the plugin, got %+v", updated.Status)
+	}
+}
+
+func TestExecDriverFailures(t *testing.T) {
+	cases := []struct {
+		mode, message string
+	}{
+		{"version", "protocol version 2, expected 1"},
+		{"error", "no such unit nxio_000001"},
+		{"crash", "unable to reach the scheduler"},
+	}
+	for _, c := range cases {
+		driver, cleanup := newHelperPlugin(t, c.mode)
+		_, err := driver.Stop(execTestService())
+		cleanup()
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("%s : expected an error containing %q, got %v", c.mode, c.message, err)
+		}
+	}
+}
+
+func TestExecDriverTimeout(t *testing.T) {
+	driver, cleanup := newHelperPlugin(t, "hang")
+	defer cleanup()
+	driver.Timeout = 200 * time.Millisecond
+
+	start := time.Now()
+	_, err := driver.Passivate(execTestService())
+	if err == nil || !strings.Contains(err.Error(), "did not answer") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the plugin to be killed, it ran for %v", elapsed)
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Filter selects services with an expression such as :
+//
+//     status in (error,warning) && lastAccess < now-7d && domain =~ ".*\.test\.io"
+//
+// Comparisons are made on a service field : name, index, nodeKey, unitName,
+// domain, host, port, status (the computed status), expected, current, alive
+// and lastAccess. Operators are ==, !=, =~ and !~ (regular expressions),
+// <, <=, >, >= (on port and lastAccess), in and not in. Comparisons can be
+// combined with &&, || and !, and grouped with parentheses. Values may be
+// quoted ; times are written as now, now-7d, now+2h or in RFC3339 format.
+type Filter struct {
+	Expression string
+	root       filterNode
+}
+
+type filterNode interface {
+	match(service *Service) bool
+}
+
+func ParseFilter(expression string) (*Filter, error) {
+	p := &filterParser{input: expression}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return &Filter{Expression: expression, root: root}, nil
+}
+
+// Match returns true if the service matches the filter. A nil filter
+// matches every service.
+func (f *Filter) Match(service *Service) bool {
+	return f == nil || f.root.match(service)
+}
+
+// FilterServices returns the services matching the filter.
+func (f *Filter) FilterServices(services []*Service) []*Service {
+	filtered := []*Service{}
+	for _, service := range services {
+		if f.Match(service) {
+			filtered = append(filtered, service)
+		}
+	}
+	return filtered
+}
+
+type andNode struct{ left, right filterNode }
+type orNode struct{ left, right filterNode }
+type notNode struct{ node filterNode }
+
+func (n *andNode) match(s *Service) bool { return n.left.match(s) && n.right.match(s) }
+func (n *orNode) match(s *Service) bool  { return n.left.match(s) || n.right.match(s) }
+func (n *notNode) match(s *Service) bool { return !n.node.match(s) }
+
+type stringComparison struct {
+	field  string
+	op     string
+	values []string
+	regexp *regexp.Regexp
+}
+
+func (c *stringComparison) match(s *Service) bool {
+	value := stringField(s, c.field)
+	switch c.op {
+	case "==":
+		return value == c.values[0]
+	case "!=":
+		return value != c.values[0]
+	case "=~":
+		return c.regexp.MatchString(value)
+	case "!~":
+		return !c.regexp.MatchString(value)
+	case "in", "not in":
+		found := false
+		for _, v := range c.values {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		return found == (c.op == "in")
+	}
+	return false
+}
+
+type intComparison struct {
+	field  string
+	op     string
+	values []int64
+}
+
+func (c *intComparison) match(s *Service) bool {
+	value := int64(0)
+	if s.Location != nil {
+		value = int64(s.Location.Port)
+	}
+	if c.op == "in" || c.op == "not in" {
+		found := false
+		for _, v := range c.values {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		return found == (c.op == "in")
+	}
+	return compareInts(value, c.values[0], c.op)
+}
+
+type timeComparison struct {
+	field string
+	op    string
+	value time.Time
+}
+
+// match compares the last access of the service. A service that was never
+// accessed is older than any time : it only matches <, <= and !=.
+func (c *timeComparison) match(s *Service) bool {
+	if s.LastAccess == nil {
+		return c.op == "<" || c.op == "<=" || c.op == "!="
+	}
+
+	value := *s.LastAccess
+	switch c.op {
+	case "==":
+		return value.Equal(c.value)
+	case "!=":
+		return !value.Equal(c.value)
+	case "<":
+		return value.Before(c.value)
+	case "<=":
+		return !value.After(c.value)
+	case ">":
+		return value.After(c.value)
+	case ">=":
+		return !value.Before(c.value)
+	}
+	return false
+}
+
+func compareInts(a, b int64, op string) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+var filterFields = map[string]string{
+	"name":       "string",
+	"index":      "string",
+	"nodeKey":    "string",
+	"unitName":   "string",
+	"domain":     "string",
+	"host":       "string",
+	"status":     "string",
+	"expected":   "string",
+	"current":    "string",
+	"alive":      "string",
+	"port":       "int",
+	"lastAccess": "time",
+}
+
+func stringField(s *Service, field string) string {
+	switch field {
+	case "name":
+		return s.Name
+	case "index":
+		return s.Index
+	case "nodeKey":
+		return s.NodeKey
+	case "unitName":
+		return s.UnitName
+	case "domain":
+		return s.Domain
+	case "host":
+		if s.Location != nil {
+			return s.Location.Host
+		}
+	case "status":
+		if s.Status != nil {
+			return s.Status.Compute()
+		}
+	case "expected":
+		if s.Status != nil {
+			return s.Status.Expected
+		}
+	case "current":
+		if s.Status != nil {
+			return s.Status.Current
+		}
+	case "alive":
+		if s.Status != nil {
+			return s.Status.Alive
+		}
+	}
+	return ""
+}
+
+const (
+	tokenWord = iota
+	tokenString
+	tokenOperator
+)
+
+type filterToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+type filterParser struct {
+	input  string
+	tokens []filterToken
+	pos    int
+}
+
+var comparisonOperators = map[string]bool{
+	"==": true, "!=": true, "=~": true, "!~": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+var filterOperators = []string{"&&", "||", "==", "!=", "=~", "!~", "<=", ">=", "<", ">", "!", "(", ")", ","}
+
+func (p *filterParser) tokenize() error {
+	input := p.input
+	for i := 0; i < len(input); {
+		c, size := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case c == '"' || c == '\'':
+			var value []rune
+			j, closed := i+size, false
+			for j < len(input) {
+				r, n := utf8.DecodeRuneInString(input[j:])
+				if r == c {
+					closed = true
+					break
+				}
+				// Only the quote may be escaped, other backslashes are kept
+				// as is so that regular expressions stay readable.
+				if r == '\\' {
+					if next, m := utf8.DecodeRuneInString(input[j+n:]); next == c {
+						r, n = next, n+m
+					}
+				}
+				value = append(value, r)
+				j += n
+			}
+			if !closed {
+				return fmt.Errorf("Invalid filter %q : unterminated string at %d", input, i)
+			}
+			p.tokens = append(p.tokens, filterToken{tokenString, string(value), i})
+			i = j + size
+		case isWordChar(c):
+			j := i
+			for j < len(input) {
+				r, n := utf8.DecodeRuneInString(input[j:])
+				if !isWordChar(r) {
+					break
+				}
+				j += n
+			}
+			p.tokens = append(p.tokens, filterToken{tokenWord, input[i:j], i})
+			i = j
+		default:
+			found := false
+			for _, op := range filterOperators {
+				if strings.HasPrefix(input[i:], op) {
+					p.tokens = append(p.tokens, filterToken{tokenOperator, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("Invalid filter %q : unexpected %q at %d", input, c, i)
+			}
+		}
+	}
+	return nil
+}
+
+func isWordChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("._-+:/@*", c)
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.done() {
+		return filterToken{kind: tokenOperator, text: "", pos: len(p.input)}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *filterParser) accept(kind int, text string) bool {
+	if t := p.peek(); !p.done() && t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid filter %q : %s at %d", p.input, fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOperator, "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOperator, "&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept(tokenOperator, "!") {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node}, nil
+	}
+
+	if p.accept(tokenOperator, "(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(tokenOperator, ")") {
+			return nil, p.errorf("expected )")
+		}
+		return node, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	fieldToken := p.next()
+	field := fieldToken.text
+	kind, ok := filterFields[field]
+	if fieldToken.kind != tokenWord || !ok {
+		p.pos--
+		return nil, p.errorf("unknown field %q", field)
+	}
+
+	var op string
+	switch {
+	case p.accept(tokenWord, "in"):
+		op = "in"
+	case p.accept(tokenWord, "not"):
+		if !p.accept(tokenWord, "in") {
+			return nil, p.errorf("expected in after not")
+		}
+		op = "not in"
+	case p.peek().kind == tokenOperator && comparisonOperators[p.peek().text]:
+		op = p.next().text
+	default:
+		return nil, p.errorf("expected an operator after %s", field)
+	}
+
+	var values []string
+	if op == "in" || op == "not in" {
+		if !p.accept(tokenOperator, "(") {
+			return nil, p.errorf("expected ( after %s", op)
+		}
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if p.accept(tokenOperator, ")") {
+				break
+			}
+			if !p.accept(tokenOperator, ",") {
+				return nil, p.errorf("expected , or )")
+			}
+		}
+	} else {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = []string{value}
+	}
+
+	switch kind {
+	case "int":
+		if op == "=~" || op == "!~" {
+			return nil, p.errorf("%s can't be used on %s", op, field)
+		}
+		ints := []int64{}
+		for _, value := range values {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, p.errorf("%s is not a number", value)
+			}
+			ints = append(ints, n)
+		}
+		return &intComparison{field: field, op: op, values: ints}, nil
+
+	case "time":
+		if op == "=~" || op == "!~" || op == "in" || op == "not in" {
+			return nil, p.errorf("%s can't be used on %s", op, field)
+		}
+		t, err := parseFilterTime(values[0], time.Now())
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return &timeComparison{field: field, op: op, value: t}, nil
+
+	default:
+		comparison := &stringComparison{field: field, op: op, values: values}
+		switch op {
+		case "<", "<=", ">", ">=":
+			return nil, p.errorf("%s can't be used on %s", op, field)
+		case "=~", "!~":
+			re, err := regexp.Compile(values[0])
+			if err != nil {
+				return nil, p.errorf("invalid regular expression : %v", err)
+			}
+			comparison.regexp = re
+		}
+		return comparison, nil
+	}
+}
+
+func (p *filterParser) parseValue() (string, error) {
+	t := p.peek()
+	if p.done() || (t.kind != tokenWord && t.kind != tokenString) {
+		return "", p.errorf("expected a value")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+var relativeTimeRegexp = regexp.MustCompile(`^now(?:([+-])(\d+)([smhdw]))?$`)
+
+// parseFilterTime parses now, now-7d, now+2h or an RFC3339 time or date.
+func parseFilterTime(value string, now time.Time) (time.Time, error) {
+	if m := relativeTimeRegexp.FindStringSubmatch(value); m != nil {
+		if m[1] == "" {
+			return now, nil
+		}
+
+		n, _ := strconv.Atoi(m[2])
+		unit := map[string]time.Duration{
+			"s": time.Second,
+			"m": time.Minute,
+			"h": time.Hour,
+			"d": 24 * time.Hour,
+			"w": 7 * 24 * time.Hour,
+		}[m[3]]
+
+		d := time.Duration(n) * unit
+		if m[1] == "-" {
+			d = -d
+		}
+		return now.Add(d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use now-7d or an RFC3339 time", value)
+}
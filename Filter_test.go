@@ -0,0 +1,166 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"testing"
+	"time"
+)
+
+func filterTestService(name, index string) *Service {
+	return &Service{
+		Name:     name,
+		Index:    index,
+		Domain:   name + ".test.io",
+		Location: &Location{Host: "172.32.46.78", Port: 8080},
+		Status:   &Status{Expected: STARTED_STATUS, Current: STARTED_STATUS, Alive: "1"},
+	}
+}
+
+func accessedAgo(s *Service, d time.Duration) *Service {
+	t := time.Now().Add(-d)
+	s.LastAccess = &t
+	return s
+}
+
+func TestFilterMatch(t *testing.T) {
+	day := 24 * time.Hour
+	services := map[string]*Service{
+		"a1":     filterTestService("a", "1"),
+		"b2":     filterTestService("b", "2"),
+		"café":   filterTestService("café", "1"),
+		"quoted": filterTestService("it's", "1"),
+		"old":    accessedAgo(filterTestService("old", "1"), 10*day),
+		"recent": accessedAgo(filterTestService("recent", "1"), day),
+	}
+
+	tests := []struct {
+		filter  string
+		service string
+		match   bool
+	}{
+		// && binds tighter than ||
+		{"name == a || name == b && index == 2", "a1", true},
+		{"(name == a || name == b) && index == 2", "a1", false},
+		{"(name == a || name == b) && index == 2", "b2", true},
+		{"!name == a", "a1", false},
+		{"!(name == a || name == b)", "b2", false},
+		{"! ! name == a", "a1", true},
+
+		// Quoting and escapes
+		{`domain == "a.test.io"`, "a1", true},
+		{`name == 'it\'s'`, "quoted", true},
+		{`name == "it's"`, "quoted", true},
+		{`domain =~ "^a\.test\.io$"`, "a1", true},
+
+		// Non-ASCII names, quoted or not
+		{`name == "café"`, "café", true},
+		{"name == café", "café", true},
+		{`name =~ "^caf.$"`, "café", true},
+
+		// Regular expressions
+		{`name =~ "^[ab]$"`, "b2", true},
+		{`name !~ "^[ab]$"`, "b2", false},
+		{`domain =~ "test"`, "a1", true},
+
+		// in and not in
+		{"name in (a, b)", "b2", true},
+		{"name not in (a, b)", "b2", false},
+		{"name not in (a, b)", "café", true},
+		{"port in (80, 8080)", "a1", true},
+		{"port not in (80, 8080)", "a1", false},
+		{"status in (error, warning)", "a1", false},
+		{"port >= 8080 && port < 8081", "a1", true},
+
+		// Relative times
+		{"lastAccess < now-7d", "old", true},
+		{"lastAccess < now-7d", "recent", false},
+		{"lastAccess > now-2d", "recent", true},
+		{"lastAccess >= now-7d && lastAccess <= now", "recent", true},
+
+		// A service never accessed is older than any time
+		{"lastAccess < now-7d", "a1", true},
+		{"lastAccess <= now", "a1", true},
+		{"lastAccess > now-7d", "a1", false},
+		{"lastAccess >= now-7d", "a1", false},
+		{"lastAccess == now", "a1", false},
+		{"lastAccess != now", "a1", true},
+	}
+
+	for _, test := range tests {
+		filter, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Errorf("%s : %v", test.filter, err)
+			continue
+		}
+		if match := filter.Match(services[test.service]); match != test.match {
+			t.Errorf("%s on %s : expected %v, got %v", test.filter, test.service, test.match, match)
+		}
+	}
+}
+
+func TestFilterMalformed(t *testing.T) {
+	filters := []string{
+		"",
+		"name",
+		"name ==",
+		"== a",
+		"name == a &&",
+		"name == a ||| name == b",
+		"(name == a",
+		"name == a)",
+		")",
+		"name == a b",
+		`name == "abc`,
+		`name == 'abc\'`,
+		"foo == a",
+		"name = a",
+		"name # a",
+		"name not a",
+		"name not in a",
+		"name in a",
+		"name in (a b)",
+		"name in (a,",
+		"name in ()",
+		"port =~ 80",
+		"port == http",
+		"name < a",
+		"lastAccess in (now)",
+		"lastAccess =~ now",
+		"lastAccess < yesterday",
+		"lastAccess < now-7y",
+		`name =~ "("`,
+		"!",
+		"été",
+	}
+
+	for _, expression := range filters {
+		if _, err := ParseFilter(expression); err == nil {
+			t.Errorf("%q : expected an error", expression)
+		}
+	}
+}
+
+func TestParseFilterTime(t *testing.T) {
+	now := time.Date(2015, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Time
+	}{
+		{"now", now},
+		{"now-7d", now.Add(-7 * 24 * time.Hour)},
+		{"now+2h", now.Add(2 * time.Hour)},
+		{"now-30m", now.Add(-30 * time.Minute)},
+		{"now-2w", now.Add(-14 * 24 * time.Hour)},
+		{"2015-03-01", time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2015-03-01T10:00:00Z", time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		value, err := parseFilterTime(test.value, now)
+		if err != nil {
+			t.Errorf("%s : %v", test.value, err)
+		} else if !value.Equal(test.expected) {
+			t.Errorf("%s : expected %v, got %v", test.value, test.expected, value)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"github.com/golang/glog"
+	"sort"
+	"time"
+)
+
+const (
+	NotifyFlappingStart = "flapping-start"
+	NotifyFlappingEnd   = "flapping-end"
+)
+
+// FlapDetector tracks the error/recovery transitions of each cluster. A
+// cluster starts flapping when it changes state more than Threshold times
+// during Window, and stops flapping once it has changed state at most
+// Threshold/2 times during Window. It is not safe for concurrent use.
+type FlapDetector struct {
+	Threshold int
+	Window    time.Duration
+
+	history  map[string][]time.Time
+	clusters map[string]*ServiceCluster
+	flapping map[string]bool
+}
+
+func NewFlapDetector(threshold int, window time.Duration) *FlapDetector {
+	return &FlapDetector{
+		Threshold: threshold,
+		Window:    window,
+		history:   make(map[string][]time.Time),
+		clusters:  make(map[string]*ServiceCluster),
+		flapping:  make(map[string]bool),
+	}
+}
+
+// Record records a transition of the cluster. It returns whether the cluster
+// is flapping and whether it just started to.
+func (fd *FlapDetector) Record(cluster *ServiceCluster, now time.Time) (flapping bool, started bool) {
+	if fd.Threshold <= 0 {
+		return false, false
+	}
+
+	fd.clusters[cluster.Name] = cluster
+	fd.history[cluster.Name] = append(fd.prune(cluster.Name, now), now)
+
+	if fd.flapping[cluster.Name] {
+		return true, false
+	}
+	if len(fd.history[cluster.Name]) > fd.Threshold {
+		fd.flapping[cluster.Name] = true
+		return true, true
+	}
+	return false, false
+}
+
+// Expire forgets old transitions and returns the clusters that stopped
+// flapping.
+func (fd *FlapDetector) Expire(now time.Time) []*ServiceCluster {
+	ended := []*ServiceCluster{}
+	for name := range fd.history {
+		history := fd.prune(name, now)
+
+		if fd.flapping[name] && len(history) <= fd.Threshold/2 {
+			delete(fd.flapping, name)
+			ended = append(ended, fd.clusters[name])
+		}
+
+		if len(history) == 0 && !fd.flapping[name] {
+			delete(fd.history, name)
+			delete(fd.clusters, name)
+		} else {
+			fd.history[name] = history
+		}
+	}
+	return ended
+}
+
+func (fd *FlapDetector) IsFlapping(name string) bool {
+	return fd.flapping[name]
+}
+
+// Flapping returns the sorted names of the flapping clusters.
+func (fd *FlapDetector) Flapping() []string {
+	names := make([]string, 0, len(fd.flapping))
+	for name := range fd.flapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (fd *FlapDetector) prune(name string, now time.Time) []time.Time {
+	history := fd.history[name]
+	i := 0
+	for i < len(history) && now.Sub(history[i]) > fd.Window {
+		i++
+	}
+	return history[i:]
+}
+
+func (cw *ClusterWatcher) flappingLoop(done chan struct{}) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			cw.lock.Lock()
+			ended := cw.flaps.Expire(time.Now())
+			lastErrors := make(map[string]error)
+			for _, cluster := range ended {
+				if state, ok := cw.inError[cluster.Name]; ok {
+					lastErrors[cluster.Name] = state.LastError
+				}
+			}
+			cw.lock.Unlock()
+
+			for _, cluster := range ended {
+				glog.Infof("Cluster %s stopped flapping", cluster.Name)
+				cw.notify(NotifyFlappingEnd, cluster, lastErrors[cluster.Name])
+			}
+			cw.updateFlappingMetrics()
+		}
+	}
+}
+
+func (cw *ClusterWatcher) updateFlappingMetrics() {
+	cw.lock.Lock()
+	flapping := cw.flaps.Flapping()
+	cw.lock.Unlock()
+
+	cw.flappingGauge.Update(int64(len(flapping)))
+	cw.exporter.SetFlapping(flapping)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlapDetectorStartsAboveThreshold(t *testing.T) {
+	fd := NewFlapDetector(4, 10*time.Minute)
+	cluster := &ServiceCluster{Name: "nxio_000001"}
+	now := time.Date(2015, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 4; i++ {
+		if flapping, _ := fd.Record(cluster, now.Add(time.Duration(i)*time.Minute)); flapping {
+			t.Fatalf("expected %d transitions not to be flapping", i+1)
+		}
+	}
+
+	flapping, started := fd.Record(cluster, now.Add(4*time.Minute))
+	if !flapping || !started {
+		t.Errorf("expected the 5th transition to start flapping, got %v, %v", flapping, started)
+	}
+	flapping, started = fd.Record(cluster, now.Add(5*time.Minute))
+	if !flapping || started {
+		t.Errorf("expected the cluster to keep flapping without starting again, got %v, %v", flapping, started)
+	}
+	if !reflect.DeepEqual(fd.Flapping(), []string{"nxio_000001"}) {
+		t.Errorf("unexpected flapping clusters %v", fd.Flapping())
+	}
+}
+
+func TestFlapDetectorOldTransitionsDoNotCount(t *testing.T) {
+	fd := NewFlapDetector(4, 10*time.Minute)
+	cluster := &ServiceCluster{Name: "nxio_000001"}
+	now := time.Date(2015, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	// One transition every 3 minutes : never more than 4 in 10 minutes
+	for i := 0; i < 20; i++ {
+		if flapping, _ := fd.Record(cluster, now.Add(time.Duration(3*i)*time.Minute)); flapping {
+			t.Fatalf("expected transition %d not to be flapping", i)
+		}
+	}
+}
+
+func TestFlapDetectorHysteresis(t *testing.T) {
+	fd := NewFlapDetector(4, 10*time.Minute)
+	cluster := &ServiceCluster{Name: "nxio_000001"}
+	now := time.Date(2015, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	// Transitions at 0, 1, 2, 3 and 4 minutes
+	for i := 0; i < 5; i++ {
+		fd.Record(cluster, now.Add(time.Duration(i)*time.Minute))
+	}
+
+	// At 11m30s, the transitions at 2, 3 and 4 minutes are left : 3 is not
+	// above the threshold, but still above Threshold/2
+	if ended := fd.Expire(now.Add(11*time.Minute + 30*time.Second)); len(ended) != 0 {
+		t.Errorf("expected the cluster to keep flapping with 3 transitions, got %v", ended)
+	}
+	if !fd.IsFlapping("nxio_000001") {
+		t.Error("expected the cluster to still be flapping")
+	}
+
+	ended := fd.Expire(now.Add(12*time.Minute + 30*time.Second))
+	if len(ended) != 1 || ended[0] != cluster {
+		t.Fatalf("expected the cluster to stop flapping with 2 transitions, got %v", ended)
+	}
+	if fd.IsFlapping("nxio_000001") || len(fd.Flapping()) != 0 {
+		t.Error("expected no flapping cluster")
+	}
+	if ended := fd.Expire(now.Add(13 * time.Minute)); len(ended) != 0 {
+		t.Errorf("expected the end of flapping to be reported once, got %v", ended)
+	}
+
+	// Once all transitions expired, the cluster is forgotten
+	fd.Expire(now.Add(time.Hour))
+	if len(fd.history) != 0 || len(fd.clusters) != 0 {
+		t.Errorf("expected the cluster to be forgotten, got %v", fd.history)
+	}
+}
+
+func TestFlapDetectorDisabled(t *testing.T) {
+	fd := NewFlapDetector(0, 10*time.Minute)
+	cluster := &ServiceCluster{Name: "nxio_000001"}
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		if flapping, _ := fd.Record(cluster, now); flapping {
+			t.Fatal("expected a threshold of 0 to disable the detection")
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const inClusterDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesConfig holds the API server to call and the credentials to use.
+type KubernetesConfig struct {
+	Server    string
+	Token     string
+	Namespace string
+	TLS       *tls.Config
+}
+
+// kubeConfigFile is the part of a kubeconfig file used by arkenctl.
+type kubeConfigFile struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// NewKubernetesConfig loads the kubeconfig file if one is given or exists in
+// ~/.kube/config, and otherwise uses the service account of the pod.
+func NewKubernetesConfig(kubeconfig, context string) (*KubernetesConfig, error) {
+	if kubeconfig == "" {
+		if home := os.Getenv("HOME"); home != "" {
+			if _, err := os.Stat(filepath.Join(home, ".kube", "config")); err == nil {
+				kubeconfig = filepath.Join(home, ".kube", "config")
+			}
+		}
+	}
+	if kubeconfig != "" {
+		// KUBECONFIG may hold several files, only the first one is used
+		return LoadKubeConfig(strings.Split(kubeconfig, string(os.PathListSeparator))[0], context)
+	}
+	return InClusterConfig()
+}
+
+// LoadKubeConfig reads the cluster, user and namespace of a context of a
+// kubeconfig file, or of its current context.
+func LoadKubeConfig(path, context string) (*KubernetesConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &kubeConfigFile{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("Invalid kubeconfig %s : %v", path, err)
+	}
+	dir := filepath.Dir(path)
+
+	if context == "" {
+		context = file.CurrentContext
+	}
+	config := &KubernetesConfig{Namespace: "default", TLS: &tls.Config{}}
+	clusterName, userName := "", ""
+	found := false
+	for _, c := range file.Contexts {
+		if c.Name == context {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+			if c.Context.Namespace != "" {
+				config.Namespace = c.Context.Namespace
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("Context %q not found in kubeconfig %s", context, path)
+	}
+
+	for _, c := range file.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		config.Server = c.Cluster.Server
+		config.TLS.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := readData(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, dir)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the certificate authority of cluster %s : %v", clusterName, err)
+		}
+		if ca != nil {
+			if config.TLS.RootCAs, err = certPool(ca); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if config.Server == "" {
+		return nil, fmt.Errorf("No server for cluster %q in kubeconfig %s", clusterName, path)
+	}
+
+	for _, u := range file.Users {
+		if u.Name != userName {
+			continue
+		}
+		config.Token = u.User.Token
+		if u.User.TokenFile != "" {
+			token, err := ioutil.ReadFile(resolvePath(u.User.TokenFile, dir))
+			if err != nil {
+				return nil, err
+			}
+			config.Token = strings.TrimSpace(string(token))
+		}
+
+		cert, err := readData(u.User.ClientCertificateData, u.User.ClientCertificate, dir)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the client certificate of user %s : %v", userName, err)
+		}
+		key, err := readData(u.User.ClientKeyData, u.User.ClientKey, dir)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the client key of user %s : %v", userName, err)
+		}
+		if cert != nil && key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid client certificate of user %s : %v", userName, err)
+			}
+			config.TLS.Certificates = []tls.Certificate{pair}
+		}
+	}
+	return config, nil
+}
+
+// InClusterConfig uses the service account mounted in the pod.
+func InClusterConfig() (*KubernetesConfig, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("No kubeconfig found and not running in a Kubernetes pod, use --kubeconfig")
+	}
+
+	token, err := ioutil.ReadFile(filepath.Join(inClusterDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(inClusterDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool, err := certPool(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &KubernetesConfig{
+		Server:    "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: "default",
+		TLS:       &tls.Config{RootCAs: pool},
+	}
+	if namespace, err := ioutil.ReadFile(filepath.Join(inClusterDir, "namespace")); err == nil {
+		config.Namespace = strings.TrimSpace(string(namespace))
+	}
+	return config, nil
+}
+
+// readData returns the base64 encoded data if set, or the content of the
+// file, or nil if none is set.
+func readData(data, file, dir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return ioutil.ReadFile(resolvePath(file, dir))
+	}
+	return nil, nil
+}
+
+// resolvePath resolves paths relative to the kubeconfig file.
+func resolvePath(path, dir string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func certPool(ca []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("Invalid certificate authority")
+	}
+	return pool, nil
+}
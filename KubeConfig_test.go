@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate and its key, both PEM
+// encoded.
+func testCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "arkenctl"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+const testKubeConfig = `
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: https://k8s.prod.nuxeo.io:6443
+    certificate-authority: certs/ca.crt
+- name: staging
+  cluster:
+    server: https://k8s.staging.nuxeo.io:6443
+    certificate-authority-data: %CA_DATA%
+- name: local
+  cluster:
+    server: https://127.0.0.1:6443
+    insecure-skip-tls-verify: true
+users:
+- name: admin
+  user:
+    client-certificate: certs/admin.crt
+    client-key: certs/admin.key
+- name: deployer
+  user:
+    tokenFile: token
+- name: robot
+  user:
+    token: r0b0t
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+- name: staging
+  context:
+    cluster: staging
+    user: deployer
+    namespace: nxio
+- name: local
+  context:
+    cluster: local
+    user: robot
+- name: orphan
+  context:
+    cluster: unknown
+    user: robot
+`
+
+// writeTestKubeConfig writes a kubeconfig referencing certificates and a
+// token file relative to its directory, and returns its path.
+func writeTestKubeConfig(t *testing.T, dir string) string {
+	cert, key := testCertificate(t)
+	if err := os.Mkdir(filepath.Join(dir, "certs"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"certs/ca.crt":    cert,
+		"certs/admin.crt": cert,
+		"certs/admin.key": key,
+		"token":           []byte("d3pl0y3r\n"),
+		"config": []byte(strings.Replace(testKubeConfig, "%CA_DATA%",
+			base64.StdEncoding.EncodeToString(cert), 1)),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "config")
+}
+
+func TestLoadKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arkenctl-kube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeTestKubeConfig(t, dir)
+
+	tests := []struct {
+		context     string
+		server      string
+		token       string
+		namespace   string
+		rootCAs     bool
+		clientCerts int
+		insecure    bool
+	}{
+		// the current context, with certificates relative to the kubeconfig
+		{"", "https://k8s.prod.nuxeo.io:6443", "", "default", true, 1, false},
+		{"prod", "https://k8s.prod.nuxeo.io:6443", "", "default", true, 1, false},
+		// inline certificate authority and a token file relative to the kubeconfig
+		{"staging", "https://k8s.staging.nuxeo.io:6443", "d3pl0y3r", "nxio", true, 0, false},
+		{"local", "https://127.0.0.1:6443", "r0b0t", "default", false, 0, true},
+	}
+
+	for _, test := range tests {
+		config, err := LoadKubeConfig(path, test.context)
+		if err != nil {
+			t.Errorf("context %q : %v", test.context, err)
+			continue
+		}
+		if config.Server != test.server {
+			t.Errorf("context %q : expected server %s, got %s", test.context, test.server, config.Server)
+		}
+		if config.Token != test.token {
+			t.Errorf("context %q : expected token %q, got %q", test.context, test.token, config.Token)
+		}
+		if config.Namespace != test.namespace {
+			t.Errorf("context %q : expected namespace %s, got %s", test.context, test.namespace, config.Namespace)
+		}
+		if (config.TLS.RootCAs != nil) != test.rootCAs {
+			t.Errorf("context %q : expected root CAs %v, got %v", test.context, test.rootCAs, config.TLS.RootCAs != nil)
+		}
+		if len(config.TLS.Certificates) != test.clientCerts {
+			t.Errorf("context %q : expected %d client certificates, got %d", test.context, test.clientCerts, len(config.TLS.Certificates))
+		}
+		if config.TLS.InsecureSkipVerify != test.insecure {
+			t.Errorf("context %q : expected insecure %v, got %v", test.context, test.insecure, config.TLS.InsecureSkipVerify)
+		}
+	}
+}
+
+func TestLoadKubeConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arkenctl-kube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeTestKubeConfig(t, dir)
+
+	tests := []struct {
+		path, context, message string
+	}{
+		{path, "dev", `Context "dev" not found`},
+		{path, "orphan", `No server for cluster "unknown"`},
+		{filepath.Join(dir, "missing"), "", "no such file"},
+		{filepath.Join(dir, "token"), "", "Invalid kubeconfig"},
+	}
+
+	for _, test := range tests {
+		_, err := LoadKubeConfig(test.path, test.context)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s context %q : expected an error containing %q, got %v", test.path, test.context, test.message, err)
+		}
+	}
+
+	// a missing relative certificate is reported, not ignored
+	if err := os.Remove(filepath.Join(dir, "certs", "ca.crt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKubeConfig(path, "prod"); err == nil || !strings.Contains(err.Error(), "certificate authority") {
+		t.Errorf("expected a certificate authority error, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	DefaultKubernetesDeployment = "{{.Name}}-{{.Index}}"
+	// PassivatedAnnotation is set on the deployments of passivated services,
+	// to the time of the passivation
+	PassivatedAnnotation = "arken.io/passivated"
+)
+
+// KubernetesServiceDriver maps each instance to a Deployment, whose name is
+// rendered from the Deployment template. Start scales it to Replicas, Stop
+// and Passivate scale it to 0, Passivate also annotates it.
+type KubernetesServiceDriver struct {
+	Config     *KubernetesConfig
+	Deployment *template.Template
+	Replicas   int
+	// Expected, if set, also writes the expected status in etcd
+	Expected *EtcdServiceDriver
+
+	client *http.Client
+}
+
+var _ drivers.ServiceDriver = (*KubernetesServiceDriver)(nil)
+
+func NewKubernetesServiceDriver(config *KubernetesConfig, deployment string, replicas int) (*KubernetesServiceDriver, error) {
+	tpl, err := template.New("deployment").Parse(deployment)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid deployment template %s : %v", deployment, err)
+	}
+	if replicas < 1 {
+		return nil, fmt.Errorf("Invalid number of replicas %d, must be at least 1", replicas)
+	}
+
+	return &KubernetesServiceDriver{
+		Config:     config,
+		Deployment: tpl,
+		Replicas:   replicas,
+		client: &http.Client{
+			Timeout:   time.Minute,
+			Transport: &http.Transport{TLSClientConfig: config.TLS},
+		},
+	}, nil
+}
+
+func (d *KubernetesServiceDriver) Start(s *Service) (*Service, error) {
+	if err := d.scale(s, d.Replicas, nil); err != nil {
+		return nil, err
+	}
+	return d.setExpected(s, STARTED_STATUS)
+}
+
+func (d *KubernetesServiceDriver) Stop(s *Service) (*Service, error) {
+	if err := d.scale(s, 0, nil); err != nil {
+		return nil, err
+	}
+	return d.setExpected(s, STOPPED_STATUS)
+}
+
+func (d *KubernetesServiceDriver) Passivate(s *Service) (*Service, error) {
+	passivated := time.Now().UTC().Format(time.RFC3339)
+	if err := d.scale(s, 0, &passivated); err != nil {
+		return nil, err
+	}
+	return d.setExpected(s, PASSIVATED_STATUS)
+}
+
+func (d *KubernetesServiceDriver) setExpected(s *Service, expected string) (*Service, error) {
+	if d.Expected == nil {
+		return s, nil
+	}
+	return d.Expected.setExpected(s, expected)
+}
+
+// dns1123Name is the format of Kubernetes resource names.
+var dns1123Name = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// DeploymentName returns the name of the deployment of the service. As Arken
+// names such as nxio_000001 are not valid Kubernetes names, the rendered name
+// is lower-cased and underscores are replaced by dashes.
+func (d *KubernetesServiceDriver) DeploymentName(s *Service) (string, error) {
+	var rendered bytes.Buffer
+	if err := d.Deployment.Execute(&rendered, s); err != nil {
+		return "", err
+	}
+
+	name := strings.Replace(strings.ToLower(strings.TrimSpace(rendered.String())), "_", "-", -1)
+	if len(name) > 253 || !dns1123Name.MatchString(name) {
+		return "", fmt.Errorf("Invalid deployment name %q for %s/%s, check --kubeDeployment", name, s.Name, s.Index)
+	}
+	return name, nil
+}
+
+// scale sets the replicas of the deployment and its passivated annotation,
+// which is removed when passivated is nil.
+func (d *KubernetesServiceDriver) scale(s *Service, replicas int, passivated *string) error {
+	name, err := d.DeploymentName(s)
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{PassivatedAnnotation: passivated},
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.do("PATCH", d.deploymentsPath()+"/"+name, "application/merge-patch+json", patch)
+}
+
+// Ping checks that the credentials allow to list the deployments of the
+// namespace.
+func (d *KubernetesServiceDriver) Ping() error {
+	return d.do("GET", d.deploymentsPath()+"?limit=1", "", nil)
+}
+
+func (d *KubernetesServiceDriver) deploymentsPath() string {
+	return "/apis/apps/v1/namespaces/" + d.Config.Namespace + "/deployments"
+}
+
+func (d *KubernetesServiceDriver) do(method, path, contentType string, body []byte) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(d.Config.Server, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if d.Config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.Config.Token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		status := struct{ Message string }{}
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(data))
+		}
+		err := fmt.Errorf("Kubernetes %s %s answered %d : %s", method, strings.SplitN(path, "?", 2)[0], resp.StatusCode, status.Message)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return &TransientError{err}
+		}
+		return err
+	}
+	return nil
+}
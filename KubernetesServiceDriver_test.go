@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	. "github.com/arkenio/goarken"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// kubeRequest is a request received by the fake API server.
+type kubeRequest struct {
+	Method      string
+	Path        string
+	ContentType string
+	Token       string
+	Patch       map[string]interface{}
+}
+
+// newFakeKubernetes starts an API server knowing the given deployments in
+// the prod namespace, and a driver using it.
+func newFakeKubernetes(t *testing.T, deployments ...string) (*KubernetesServiceDriver, *[]*kubeRequest, func()) {
+	requests := []*kubeRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &kubeRequest{
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			ContentType: r.Header.Get("Content-Type"),
+			Token:       r.Header.Get("Authorization"),
+		}
+		if body, _ := ioutil.ReadAll(r.Body); len(body) > 0 {
+			json.Unmarshal(body, &req.Patch)
+		}
+		requests = append(requests, req)
+
+		for _, name := range deployments {
+			if r.URL.Path == "/apis/apps/v1/namespaces/prod/deployments/"+name {
+				w.Write([]byte(`{"kind":"Deployment"}`))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"kind":"Status","message":"deployments.apps \"` + r.URL.Path + `\" not found"}`))
+	}))
+
+	config := &KubernetesConfig{Server: server.URL, Token: "secret", Namespace: "prod"}
+	driver, err := NewKubernetesServiceDriver(config, DefaultKubernetesDeployment, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver, &requests, server.Close
+}
+
+func kubeService() *Service {
+	return &Service{Name: "nxio_000001", Index: "1"}
+}
+
+func TestKubernetesDriverPatches(t *testing.T) {
+	driver, requests, stop := newFakeKubernetes(t, "nxio-000001-1")
+	defer stop()
+
+	cases := []struct {
+		operation  ServiceAction
+		replicas   float64
+		passivated bool
+	}{
+		{driver.Start, 2, false},
+		{driver.Stop, 0, false},
+		{driver.Passivate, 0, true},
+	}
+
+	for i, c := range cases {
+		if _, err := c.operation(kubeService()); err != nil {
+			t.Fatalf("call %d : unexpected error %v", i, err)
+		}
+
+		req := (*requests)[len(*requests)-1]
+		if req.Method != "PATCH" || req.Path != "/apis/apps/v1/namespaces/prod/deployments/nxio-000001-1" {
+			t.Errorf("call %d : unexpected request %s %s", i, req.Method, req.Path)
+		}
+		if req.ContentType != "application/merge-patch+json" || req.Token != "Bearer secret" {
+			t.Errorf("call %d : unexpected headers %s, %s", i, req.ContentType, req.Token)
+		}
+
+		spec := req.Patch["spec"].(map[string]interface{})
+		if spec["replicas"] != c.replicas {
+			t.Errorf("call %d : expected %v replicas, got %v", i, c.replicas, spec["replicas"])
+		}
+
+		annotations := req.Patch["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+		annotation, ok := annotations[PassivatedAnnotation]
+		if !ok {
+			t.Errorf("call %d : the passivated annotation must always be patched", i)
+		}
+		if c.passivated && annotation == nil {
+			t.Errorf("call %d : expected the passivated annotation to be set", i)
+		}
+		if !c.passivated && annotation != nil {
+			t.Errorf("call %d : expected the passivated annotation to be removed, got %v", i, annotation)
+		}
+	}
+}
+
+func TestKubernetesDriverMissingDeployment(t *testing.T) {
+	driver, _, stop := newFakeKubernetes(t)
+	defer stop()
+
+	_, err := driver.Start(kubeService())
+	if err == nil || !strings.Contains(err.Error(), "answered 404") || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	if _, ok := err.(*TransientError); ok {
+		t.Errorf("a 404 must not be transient")
+	}
+}
+
+func TestKubernetesDeploymentName(t *testing.T) {
+	config := &KubernetesConfig{Namespace: "prod"}
+
+	driver, _ := NewKubernetesServiceDriver(config, "{{.Name}}", 1)
+	if name, err := driver.DeploymentName(&Service{Name: "NXIO_000001"}); err != nil || name != "nxio-000001" {
+		t.Errorf("expected nxio-000001, got %q (%v)", name, err)
+	}
+
+	driver, _ = NewKubernetesServiceDriver(config, "{{.UnitName}}", 1)
+	if _, err := driver.DeploymentName(&Service{UnitName: "nxio@1.service"}); err == nil {
+		t.Errorf("expected nxio@1.service to be rejected")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/golang/glog"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LeaderClient is the part of the etcd client used by the leader election,
+// so that it can be replaced by a fake in tests.
+type LeaderClient interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Create(key string, value string, ttl uint64) (*etcd.Response, error)
+	CompareAndSwap(key string, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
+	CompareAndDelete(key string, prevValue string, prevIndex uint64) (*etcd.Response, error)
+}
+
+// LeaderElection elects a leader among several watchers using a TTL key in
+// etcd. The leader refreshes the key every TTL/3, standbys try to create it
+// at the same pace and take over when it expires.
+type LeaderElection struct {
+	Client LeaderClient
+	Prefix string
+	ID     string
+	TTL    uint64
+
+	lock   sync.RWMutex
+	leader bool
+}
+
+func NewLeaderElection(client LeaderClient, prefix string, id string, ttl uint64) *LeaderElection {
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	return &LeaderElection{
+		Client: client,
+		Prefix: prefix,
+		ID:     id,
+		TTL:    ttl,
+	}
+}
+
+func (le *LeaderElection) Key() string {
+	return le.Prefix + "/leader"
+}
+
+func (le *LeaderElection) IsLeader() bool {
+	le.lock.RLock()
+	defer le.lock.RUnlock()
+	return le.leader
+}
+
+// Run campaigns until done is closed, then resigns.
+func (le *LeaderElection) Run(done chan struct{}) {
+	interval := time.Duration(le.TTL) * time.Second / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			le.Resign()
+			return
+		case <-ticker.C:
+			le.Campaign()
+		}
+	}
+}
+
+// Campaign refreshes the leader key if we are the leader, or tries to
+// acquire it otherwise.
+func (le *LeaderElection) Campaign() bool {
+	le.lock.Lock()
+	defer le.lock.Unlock()
+
+	wasLeader := le.leader
+
+	if le.leader {
+		if _, err := le.Client.CompareAndSwap(le.Key(), le.ID, le.TTL, le.ID, 0); err != nil {
+			glog.Errorf("Unable to refresh leadership on %s : %v", le.Key(), err)
+			le.leader = false
+		}
+	}
+
+	if !le.leader {
+		_, err := le.Client.Create(le.Key(), le.ID, le.TTL)
+		le.leader = err == nil
+	}
+
+	if le.leader != wasLeader {
+		if le.leader {
+			glog.Infof("%s is now the leader", le.ID)
+		} else {
+			glog.Infof("%s is now a standby", le.ID)
+		}
+	}
+	return le.leader
+}
+
+func (le *LeaderElection) Resign() {
+	le.lock.Lock()
+	defer le.lock.Unlock()
+
+	if le.leader {
+		le.Client.CompareAndDelete(le.Key(), le.ID, 0)
+		le.leader = false
+	}
+}
+
+// Leader returns the id of the current leader and the number of seconds
+// before its lease expires, or an empty id if there is no leader.
+func (le *LeaderElection) Leader() (string, int64, error) {
+	resp, err := le.Client.Get(le.Key(), false, false)
+	if err != nil {
+		if etcdErr, ok := err.(*etcd.EtcdError); ok && etcdErr.ErrorCode == 100 {
+			return "", 0, nil
+		}
+		return "", 0, err
+	}
+	return resp.Node.Value, resp.Node.TTL, nil
+}
+
+func (le *LeaderElection) PrintStatus(w io.Writer) error {
+	leader, ttl, err := le.Leader()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Election key : %s\n", le.Key())
+	if leader == "" {
+		fmt.Fprintln(w, "Leader : none")
+	} else {
+		fmt.Fprintf(w, "Leader : %s (lease expires in %ds)\n", leader, ttl)
+	}
+	return nil
+}
+
+// LeaderNotifier only forwards notifications when the election is won.
+type LeaderNotifier struct {
+	Election *LeaderElection
+	Notifier Notifier
+}
+
+func (ln *LeaderNotifier) Notify(n *Notification) error {
+	if !ln.Election.IsLeader() {
+		glog.Infof("Not the leader, notification %q not sent", n.Title)
+		return nil
+	}
+	return ln.Notifier.Notify(n)
+}
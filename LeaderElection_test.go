@@ -0,0 +1,180 @@
+package main
+
+import (
+	"github.com/coreos/go-etcd/etcd"
+	"testing"
+	"time"
+)
+
+type fakeLeaderKey struct {
+	value   string
+	expires time.Time
+}
+
+// fakeLeaderClient keeps TTL keys in memory. Time only moves with advance,
+// so that tests can expire a lease.
+type fakeLeaderClient struct {
+	keys map[string]*fakeLeaderKey
+	now  time.Time
+}
+
+func newFakeLeaderClient() *fakeLeaderClient {
+	return &fakeLeaderClient{keys: make(map[string]*fakeLeaderKey), now: time.Now()}
+}
+
+func (f *fakeLeaderClient) advance(d time.Duration) {
+	f.now = f.now.Add(d)
+}
+
+func (f *fakeLeaderClient) lookup(key string) (*fakeLeaderKey, error) {
+	k, ok := f.keys[key]
+	if !ok || !f.now.Before(k.expires) {
+		delete(f.keys, key)
+		return nil, &etcd.EtcdError{ErrorCode: 100, Message: "Key not found", Cause: key}
+	}
+	return k, nil
+}
+
+func (f *fakeLeaderClient) response(key string, k *fakeLeaderKey) *etcd.Response {
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: k.value, TTL: int64(k.expires.Sub(f.now) / time.Second)}}
+}
+
+func (f *fakeLeaderClient) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	k, err := f.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	return f.response(key, k), nil
+}
+
+func (f *fakeLeaderClient) Create(key string, value string, ttl uint64) (*etcd.Response, error) {
+	if _, err := f.lookup(key); err == nil {
+		return nil, &etcd.EtcdError{ErrorCode: 105, Message: "Key already exists", Cause: key}
+	}
+	k := &fakeLeaderKey{value: value, expires: f.now.Add(time.Duration(ttl) * time.Second)}
+	f.keys[key] = k
+	return f.response(key, k), nil
+}
+
+func (f *fakeLeaderClient) CompareAndSwap(key string, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	k, err := f.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if k.value != prevValue {
+		return nil, &etcd.EtcdError{ErrorCode: 101, Message: "Compare failed", Cause: key}
+	}
+	k.value, k.expires = value, f.now.Add(time.Duration(ttl)*time.Second)
+	return f.response(key, k), nil
+}
+
+func (f *fakeLeaderClient) CompareAndDelete(key string, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	k, err := f.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if k.value != prevValue {
+		return nil, &etcd.EtcdError{ErrorCode: 101, Message: "Compare failed", Cause: key}
+	}
+	delete(f.keys, key)
+	return &etcd.Response{}, nil
+}
+
+func assertLeader(t *testing.T, client *fakeLeaderClient, expected string) {
+	id, _, err := NewLeaderElection(client, "/arkenctl", "observer", 30).Leader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != expected {
+		t.Errorf("expected %q to be the leader, got %q", expected, id)
+	}
+}
+
+func TestLeaderElectionAcquireAndRefresh(t *testing.T) {
+	client := newFakeLeaderClient()
+	first := NewLeaderElection(client, "/arkenctl", "first", 30)
+	second := NewLeaderElection(client, "/arkenctl", "second", 30)
+
+	if !first.Campaign() {
+		t.Fatal("expected first to acquire the leadership")
+	}
+	if second.Campaign() {
+		t.Fatal("expected second to stay a standby")
+	}
+
+	// Refreshing by CAS keeps the lease alive past the initial TTL
+	for i := 0; i < 5; i++ {
+		client.advance(10 * time.Second)
+		if !first.Campaign() {
+			t.Fatal("expected first to refresh its leadership")
+		}
+		if second.Campaign() {
+			t.Fatal("expected second to stay a standby")
+		}
+	}
+	assertLeader(t, client, "first")
+	if _, ttl, _ := first.Leader(); ttl != 30 {
+		t.Errorf("expected the lease to be refreshed to 30s, got %ds", ttl)
+	}
+}
+
+func TestLeaderElectionLoseOnFailedRefresh(t *testing.T) {
+	client := newFakeLeaderClient()
+	first := NewLeaderElection(client, "/arkenctl", "first", 30)
+	first.Campaign()
+
+	// Another watcher took the key, e.g. after a partition
+	client.keys[first.Key()].value = "other"
+
+	if first.Campaign() {
+		t.Error("expected first to lose the leadership when the CAS fails")
+	}
+	if first.IsLeader() {
+		t.Error("expected first to be a standby")
+	}
+	assertLeader(t, client, "other")
+}
+
+func TestLeaderElectionTakeoverAfterExpiry(t *testing.T) {
+	client := newFakeLeaderClient()
+	first := NewLeaderElection(client, "/arkenctl", "first", 30)
+	second := NewLeaderElection(client, "/arkenctl", "second", 30)
+	first.Campaign()
+
+	// first stops refreshing its lease
+	client.advance(29 * time.Second)
+	if second.Campaign() {
+		t.Fatal("expected second to wait for the lease to expire")
+	}
+	client.advance(2 * time.Second)
+	if !second.Campaign() {
+		t.Fatal("expected second to take over once the lease expired")
+	}
+	assertLeader(t, client, "second")
+
+	if first.Campaign() {
+		t.Error("expected first to step down when it comes back")
+	}
+}
+
+func TestLeaderElectionResign(t *testing.T) {
+	client := newFakeLeaderClient()
+	first := NewLeaderElection(client, "/arkenctl", "first", 30)
+	second := NewLeaderElection(client, "/arkenctl", "second", 30)
+	first.Campaign()
+	second.Campaign()
+
+	// A standby resigning must not delete the key of the leader
+	second.Resign()
+	assertLeader(t, client, "first")
+
+	first.Resign()
+	if first.IsLeader() {
+		t.Error("expected first to be a standby after resigning")
+	}
+	assertLeader(t, client, "")
+
+	if !second.Campaign() {
+		t.Error("expected second to acquire the leadership right after the resignation")
+	}
+}
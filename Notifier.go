@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/golang/glog"
+	datadog "github.com/vistarmedia/go-datadog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NotifyError    = "error"
+	NotifyRecovery = "recovery"
+)
+
+// Notification is the payload sent to every notifier when a cluster
+// changes state.
+type Notification struct {
+	Kind      string    `json:"kind"`
+	Cluster   string    `json:"cluster"`
+	Title     string    `json:"title"`
+	Text      string    `json:"text"`
+	AlertType string    `json:"alertType"`
+	Error     string    `json:"error,omitempty"`
+	ErrorKind string    `json:"errorKind,omitempty"`
+	Tags      []string  `json:"tags"`
+	Time      time.Time `json:"time"`
+
+	ServiceCluster *ServiceCluster `json:"-"`
+}
+
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// MultiNotifier forwards notifications to all its notifiers. A failing
+// notifier does not prevent the others from being called.
+type MultiNotifier struct {
+	Notifiers []Notifier
+}
+
+func (mn *MultiNotifier) Notify(n *Notification) error {
+	var lastErr error
+	for _, notifier := range mn.Notifiers {
+		if err := notifier.Notify(n); err != nil {
+			glog.Errorf("Unable to send notification %q : %v", n.Title, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// NotificationQueueSize is the number of notifications the watcher keeps
+// while its notifiers are busy.
+const NotificationQueueSize = 100
+
+// AsyncNotifier sends the notifications from a dedicated goroutine, so that
+// a slow notifier does not block the cluster checks. Notifications are
+// dropped when its queue is full.
+type AsyncNotifier struct {
+	Notifier Notifier
+
+	lock   sync.RWMutex
+	closed bool
+	queue  chan *Notification
+	done   chan struct{}
+}
+
+func NewAsyncNotifier(notifier Notifier, size int) *AsyncNotifier {
+	an := &AsyncNotifier{
+		Notifier: notifier,
+		queue:    make(chan *Notification, size),
+		done:     make(chan struct{}),
+	}
+	go an.run()
+	return an
+}
+
+func (an *AsyncNotifier) run() {
+	defer close(an.done)
+	for n := range an.queue {
+		if err := an.Notifier.Notify(n); err != nil {
+			glog.Errorf("Unable to send notification %q : %v", n.Title, err)
+		}
+	}
+}
+
+// Notify queues the notification and returns without waiting for it to be
+// sent.
+func (an *AsyncNotifier) Notify(n *Notification) error {
+	an.lock.RLock()
+	defer an.lock.RUnlock()
+	if an.closed {
+		return fmt.Errorf("Notifier closed, notification %q dropped", n.Title)
+	}
+
+	select {
+	case an.queue <- n:
+		return nil
+	default:
+		glog.Errorf("Notification queue full, notification %q dropped", n.Title)
+		return fmt.Errorf("Notification queue full, notification %q dropped", n.Title)
+	}
+}
+
+// Close waits for the queued notifications to be sent. Notifications are
+// dropped once closed.
+func (an *AsyncNotifier) Close() {
+	an.lock.Lock()
+	if !an.closed {
+		an.closed = true
+		close(an.queue)
+	}
+	an.lock.Unlock()
+	<-an.done
+}
+
+type LogNotifier struct{}
+
+func (ln *LogNotifier) Notify(n *Notification) error {
+	if n.AlertType == "error" {
+		glog.Errorf("[notify] %s", n.Title)
+	} else {
+		glog.Infof("[notify] %s", n.Title)
+	}
+	return nil
+}
+
+type DatadogNotifier struct {
+	Client *datadog.Client
+}
+
+func NewDatadogNotifier(apiKey string) *DatadogNotifier {
+	host, _ := os.Hostname()
+	return &DatadogNotifier{Client: datadog.New(host, apiKey)}
+}
+
+func (dn *DatadogNotifier) Notify(n *Notification) error {
+	return dn.Client.PostEvent(&datadog.Event{
+		Title:     n.Title,
+		Text:      "%%%\n" + n.Text + "\n%%%",
+		Priority:  "normal",
+		Tags:      n.Tags,
+		AlertType: n.AlertType,
+	})
+}
+
+// WebhookNotifier POSTs the notification as JSON to an URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (wn *WebhookNotifier) Notify(n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return postJSON(wn.Client, wn.URL, body)
+}
+
+func postJSON(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered with status %s", url, resp.Status)
+	}
+	return nil
+}
+
+// DefaultCommandNotifierTimeout bounds the run of a notification command.
+const DefaultCommandNotifierTimeout = 30 * time.Second
+
+// CommandNotifier runs a command for each notification with sh -c, so it may
+// use quotes, pipes or redirections. The notification is written as JSON on
+// the command's stdin and its main fields are also exported as ARKEN_*
+// environment variables. The command is killed if it does not complete
+// within Timeout.
+type CommandNotifier struct {
+	Command string
+	Timeout time.Duration
+}
+
+func NewCommandNotifier(command string) *CommandNotifier {
+	return &CommandNotifier{Command: command, Timeout: DefaultCommandNotifierTimeout}
+}
+
+func (cn *CommandNotifier) Notify(n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	timeout := cn.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandNotifierTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", cn.Command)
+	// Do not wait for children of the shell still holding the output open
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"ARKEN_NOTIFICATION_KIND="+n.Kind,
+		"ARKEN_CLUSTER="+n.Cluster,
+		"ARKEN_TITLE="+n.Title,
+		"ARKEN_ALERT_TYPE="+n.AlertType,
+	)
+
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %v", cn.Command, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed : %v (%s)", cn.Command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// NewNotifier creates a notifier from a --notify spec. Supported specs are :
+//
+//     log
+//     datadog
+//     webhook:<url>
+//     slack:<incoming webhook url>
+//     exec:<command>
+func NewNotifier(spec string, dataDogAPIKey string) (Notifier, error) {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+
+	switch kind {
+	case "log":
+		return &LogNotifier{}, nil
+	case "datadog":
+		if dataDogAPIKey == "" {
+			return nil, errors.New("The datadog notifier needs a datadog API key")
+		}
+		return NewDatadogNotifier(dataDogAPIKey), nil
+	case "webhook":
+		if arg == "" {
+			return nil, errors.New("The webhook notifier needs an URL : webhook:<url>")
+		}
+		return NewWebhookNotifier(arg), nil
+	case "slack", "mattermost":
+		if arg == "" {
+			return nil, errors.New("The slack notifier needs an incoming webhook URL : slack:<url>")
+		}
+		return NewSlackNotifier(arg), nil
+	case "exec":
+		if strings.TrimSpace(arg) == "" {
+			return nil, errors.New("The exec notifier needs a command : exec:<command>")
+		}
+		return NewCommandNotifier(arg), nil
+	default:
+		return nil, fmt.Errorf("Unknown notifier : %s", spec)
+	}
+}
+
+// NewMultiNotifier creates a notifier for each spec. Without any spec,
+// notifications are logged and, if an API key is given, sent to datadog.
+func NewMultiNotifier(specs []string, dataDogAPIKey string) (*MultiNotifier, error) {
+	if len(specs) == 0 {
+		specs = []string{"log"}
+		if dataDogAPIKey != "" {
+			specs = append(specs, "datadog")
+		}
+	}
+
+	mn := &MultiNotifier{}
+	for _, spec := range specs {
+		notifier, err := NewNotifier(spec, dataDogAPIKey)
+		if err != nil {
+			return nil, err
+		}
+		mn.Notifiers = append(mn.Notifiers, notifier)
+	}
+	return mn, nil
+}
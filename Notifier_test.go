@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeScript(t *testing.T, dir, content string) string {
+	script := filepath.Join(dir, "notify.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"+content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestCommandNotifierQuotedArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	script := writeScript(t, dir, `{ echo "$1"; echo "$ARKEN_CLUSTER"; cat; } > "$2"`+"\n")
+
+	cn := NewCommandNotifier(script + ` "hello world" ` + out)
+	err = cn.Notify(&Notification{Kind: NotifyError, Cluster: "nxio_000001", Title: "nxio_000001 is in error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(content), "\n", 3)
+	if lines[0] != "hello world" {
+		t.Errorf("expected the quoted argument to be kept, got %q", lines[0])
+	}
+	if lines[1] != "nxio_000001" {
+		t.Errorf("expected ARKEN_CLUSTER to be exported, got %q", lines[1])
+	}
+	if !strings.Contains(lines[2], `"cluster":"nxio_000001"`) {
+		t.Errorf("expected the JSON notification on stdin, got %q", lines[2])
+	}
+}
+
+func TestCommandNotifierFailure(t *testing.T) {
+	cn := NewCommandNotifier("echo boom >&2; exit 3")
+	err := cn.Notify(&Notification{Title: "test"})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected the command output in the error, got %v", err)
+	}
+}
+
+func TestCommandNotifierTimeout(t *testing.T) {
+	cn := &CommandNotifier{Command: "sleep 10", Timeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	err := cn.Notify(&Notification{Title: "test"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be killed, it ran for %v", elapsed)
+	}
+}
+
+// blockingNotifier records the notifications, each one once released.
+type blockingNotifier struct {
+	release chan struct{}
+	lock    sync.Mutex
+	titles  []string
+}
+
+func (bn *blockingNotifier) Notify(n *Notification) error {
+	<-bn.release
+	bn.lock.Lock()
+	defer bn.lock.Unlock()
+	bn.titles = append(bn.titles, n.Title)
+	return nil
+}
+
+func TestAsyncNotifierDoesNotBlock(t *testing.T) {
+	bn := &blockingNotifier{release: make(chan struct{})}
+	an := NewAsyncNotifier(bn, 10)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			if err := an.Notify(&Notification{Title: fmt.Sprintf("n%d", i)}); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Notify blocked on a busy notifier")
+	}
+
+	close(bn.release)
+	an.Close()
+	if expected := []string{"n0", "n1", "n2"}; !reflect.DeepEqual(bn.titles, expected) {
+		t.Errorf("expected the queued notifications to be sent in order on close, got %v", bn.titles)
+	}
+}
+
+func TestAsyncNotifierDropsWhenFull(t *testing.T) {
+	bn := &blockingNotifier{release: make(chan struct{})}
+	an := NewAsyncNotifier(bn, 2)
+
+	dropped := 0
+	for i := 0; i < 5; i++ {
+		if err := an.Notify(&Notification{Title: fmt.Sprintf("n%d", i)}); err != nil {
+			dropped++
+		}
+	}
+	// one notification is being sent, two are queued
+	if dropped < 2 || dropped > 3 {
+		t.Errorf("expected the notifications beyond the queue to be dropped, got %d dropped", dropped)
+	}
+
+	close(bn.release)
+	an.Close()
+	if len(bn.titles)+dropped != 5 {
+		t.Errorf("expected every notification to be sent or dropped, got %d sent and %d dropped", len(bn.titles), dropped)
+	}
+	if err := an.Notify(&Notification{Title: "late"}); err == nil {
+		t.Error("expected an error once closed")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"gopkg.in/yaml.v2"
+	"io"
+	"sort"
+	"time"
+)
+
+// ServiceOutput is the stable schema used to render a service in JSON or
+// YAML. Timestamps are in ISO-8601 format.
+type ServiceOutput struct {
+	Name       string          `json:"name" yaml:"name"`
+	Index      string          `json:"index" yaml:"index"`
+	NodeKey    string          `json:"nodeKey" yaml:"nodeKey"`
+	UnitName   string          `json:"unitName" yaml:"unitName"`
+	Domain     string          `json:"domain" yaml:"domain"`
+	Location   *LocationOutput `json:"location" yaml:"location"`
+	Status     *StatusOutput   `json:"status" yaml:"status"`
+	LastAccess *string         `json:"lastAccess" yaml:"lastAccess"`
+}
+
+type LocationOutput struct {
+	Host string `json:"host" yaml:"host"`
+	Port int    `json:"port" yaml:"port"`
+}
+
+type StatusOutput struct {
+	Expected string `json:"expected" yaml:"expected"`
+	Current  string `json:"current" yaml:"current"`
+	Alive    string `json:"alive" yaml:"alive"`
+	Computed string `json:"computed" yaml:"computed"`
+}
+
+type DomainOutput struct {
+	Name     string           `json:"name" yaml:"name"`
+	Type     string           `json:"type" yaml:"type"`
+	Value    string           `json:"value" yaml:"value"`
+	Services []*ServiceOutput `json:"services,omitempty" yaml:"services,omitempty"`
+}
+
+func NewServiceOutput(service *Service) *ServiceOutput {
+	out := &ServiceOutput{
+		Name:     service.Name,
+		Index:    service.Index,
+		NodeKey:  service.NodeKey,
+		UnitName: service.UnitName,
+		Domain:   service.Domain,
+	}
+	if service.Location != nil {
+		out.Location = &LocationOutput{Host: service.Location.Host, Port: service.Location.Port}
+	}
+	if service.Status != nil {
+		out.Status = &StatusOutput{
+			Expected: service.Status.Expected,
+			Current:  service.Status.Current,
+			Alive:    service.Status.Alive,
+			Computed: service.Status.Compute(),
+		}
+	}
+	if service.LastAccess != nil {
+		lastAccess := service.LastAccess.UTC().Format(time.RFC3339)
+		out.LastAccess = &lastAccess
+	}
+	return out
+}
+
+func NewServiceOutputs(services []*Service) []*ServiceOutput {
+	outputs := make([]*ServiceOutput, 0, len(services))
+	for _, service := range services {
+		outputs = append(outputs, NewServiceOutput(service))
+	}
+	return outputs
+}
+
+// checkOutputFormat returns an error if the format is not supported. An
+// empty format means the default text output.
+func checkOutputFormat(format string) error {
+	switch format {
+	case "", "text", "json", "yaml":
+		return nil
+	default:
+		return fmt.Errorf("Unknown output format %q, use json or yaml", format)
+	}
+}
+
+func isStructuredOutput(format string) bool {
+	return format == "json" || format == "yaml"
+}
+
+func writeOutput(format string, v interface{}, wr io.Writer) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(wr, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = wr.Write(data)
+		return err
+	default:
+		return checkOutputFormat(format)
+	}
+}
+
+// sortServices sorts services by name, then by index.
+func sortServices(services []*Service) {
+	sort.Sort(byNameAndIndex(services))
+}
+
+type byNameAndIndex []*Service
+
+func (s byNameAndIndex) Len() int      { return len(s) }
+func (s byNameAndIndex) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byNameAndIndex) Less(i, j int) bool {
+	if s[i].Name != s[j].Name {
+		return s[i].Name < s[j].Name
+	}
+	return s[i].Index < s[j].Index
+}
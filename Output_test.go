@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	. "github.com/arkenio/goarken"
+	"testing"
+	"time"
+)
+
+func testOutputServices() []*Service {
+	lastAccess := time.Date(2015, 3, 12, 15, 4, 5, 0, time.FixedZone("CET", 3600))
+	return []*Service{
+		{
+			Name:       "nxio_000472",
+			Index:      "1",
+			NodeKey:    "/services/nxio_000472/1",
+			UnitName:   "nxio@000472.service",
+			Domain:     "nxio-000472.trial.nuxeo.io",
+			Location:   &Location{Host: "10.0.0.12", Port: 49153},
+			Status:     &Status{Expected: STARTED_STATUS, Current: STARTED_STATUS, Alive: "1"},
+			LastAccess: &lastAccess,
+		},
+		{
+			Name:    "nxio_000472",
+			Index:   "2",
+			NodeKey: "/services/nxio_000472/2",
+		},
+	}
+}
+
+const serviceGolden = `{
+  "name": "nxio_000472",
+  "index": "1",
+  "nodeKey": "/services/nxio_000472/1",
+  "unitName": "nxio@000472.service",
+  "domain": "nxio-000472.trial.nuxeo.io",
+  "location": {
+    "host": "10.0.0.12",
+    "port": 49153
+  },
+  "status": {
+    "expected": "started",
+    "current": "started",
+    "alive": "1",
+    "computed": "started"
+  },
+  "lastAccess": "2015-03-12T14:04:05Z"
+}
+`
+
+const domainGolden = `{
+  "name": "nxio-000472.trial.nuxeo.io",
+  "type": "service",
+  "value": "nxio_000472",
+  "services": [
+    {
+      "name": "nxio_000472",
+      "index": "1",
+      "nodeKey": "/services/nxio_000472/1",
+      "unitName": "nxio@000472.service",
+      "domain": "nxio-000472.trial.nuxeo.io",
+      "location": {
+        "host": "10.0.0.12",
+        "port": 49153
+      },
+      "status": {
+        "expected": "started",
+        "current": "started",
+        "alive": "1",
+        "computed": "started"
+      },
+      "lastAccess": "2015-03-12T14:04:05Z"
+    },
+    {
+      "name": "nxio_000472",
+      "index": "2",
+      "nodeKey": "/services/nxio_000472/2",
+      "unitName": "",
+      "domain": "",
+      "location": null,
+      "status": null,
+      "lastAccess": null
+    }
+  ]
+}
+`
+
+const redirectGolden = `{
+  "name": "www.nuxeo.io",
+  "type": "uri",
+  "value": "http://www.nuxeo.com/"
+}
+`
+
+func TestServiceOutputGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeOutput("json", NewServiceOutput(testOutputServices()[0]), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != serviceGolden {
+		t.Errorf("expected :\n%s\ngot :\n%s", serviceGolden, buf.String())
+	}
+}
+
+func TestDomainOutputGolden(t *testing.T) {
+	tests := []struct {
+		domain *DomainOutput
+		golden string
+	}{
+		{&DomainOutput{
+			Name:     "nxio-000472.trial.nuxeo.io",
+			Type:     "service",
+			Value:    "nxio_000472",
+			Services: NewServiceOutputs(testOutputServices()),
+		}, domainGolden},
+		{&DomainOutput{Name: "www.nuxeo.io", Type: "uri", Value: "http://www.nuxeo.com/"}, redirectGolden},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writeOutput("json", test.domain, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.golden {
+			t.Errorf("expected :\n%s\ngot :\n%s", test.golden, buf.String())
+		}
+	}
+}
+
+func TestWriteOutputUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeOutput("xml", &DomainOutput{}, &buf); err == nil {
+		t.Error("expected an error for the xml format")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got %q", buf.String())
+	}
+}
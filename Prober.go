@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ErrorKindStatus      = "status"
+	ErrorKindUnreachable = "unreachable"
+)
+
+// UnreachableError is returned when an instance marked as started does not
+// answer on its location.
+type UnreachableError struct {
+	Service *Service
+	Err     error
+}
+
+func (e UnreachableError) Error() string {
+	return fmt.Sprintf("instance %s/%s at %s is unreachable : %v",
+		e.Service.Name, e.Service.Index, locationOf(e.Service), e.Err)
+}
+
+// Prober actively checks that the started instances of a cluster answer on
+// their location. It always dials the location and, if HTTPPath is set,
+// also GETs it and expects ExpectedStatus.
+type Prober struct {
+	Timeout        time.Duration
+	HTTPPath       string
+	ExpectedStatus int
+
+	client *http.Client
+}
+
+func NewProber(timeout time.Duration, httpPath string, expectedStatus int) *Prober {
+	if httpPath != "" && !strings.HasPrefix(httpPath, "/") {
+		httpPath = "/" + httpPath
+	}
+	return &Prober{
+		Timeout:        timeout,
+		HTTPPath:       httpPath,
+		ExpectedStatus: expectedStatus,
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// ProbeCluster probes every started instance of the cluster and returns the
+// first UnreachableError found.
+func (p *Prober) ProbeCluster(cluster *ServiceCluster) error {
+	for _, service := range cluster.GetInstances() {
+		if service.Location == nil || service.Status == nil || service.Status.Compute() != STARTED_STATUS {
+			continue
+		}
+		if err := p.Probe(service); err != nil {
+			return UnreachableError{Service: service, Err: err}
+		}
+	}
+	return nil
+}
+
+func (p *Prober) Probe(service *Service) error {
+	address := net.JoinHostPort(service.Location.Host, strconv.Itoa(service.Location.Port))
+
+	conn, err := net.DialTimeout("tcp", address, p.Timeout)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+
+	if p.HTTPPath == "" {
+		return nil
+	}
+
+	resp, err := p.client.Get(fmt.Sprintf("http://%s%s", address, p.HTTPPath))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != p.ExpectedStatus {
+		return fmt.Errorf("GET %s answered %d, expected %d", p.HTTPPath, resp.StatusCode, p.ExpectedStatus)
+	}
+	return nil
+}
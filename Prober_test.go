@@ -0,0 +1,138 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serviceAt returns a started instance located at the given address.
+func serviceAt(t *testing.T, index, address string) *Service {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Service{
+		Name:     "nxio_000001",
+		Index:    index,
+		Location: &Location{Host: host, Port: p},
+		Status:   &Status{Expected: STARTED_STATUS, Current: STARTED_STATUS, Alive: "1"},
+	}
+}
+
+// closedAddress returns an address nothing listens on anymore.
+func closedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+	return address
+}
+
+func TestProbeTCPOnly(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	p := NewProber(time.Second, "", 0)
+	if err := p.Probe(serviceAt(t, "1", l.Addr().String())); err != nil {
+		t.Errorf("expected a listening instance to be reachable, got %v", err)
+	}
+	if err := p.Probe(serviceAt(t, "1", closedAddress(t))); err == nil {
+		t.Error("expected a closed port to be unreachable")
+	}
+}
+
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/health", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		path     string
+		expected int
+		message  string
+	}{
+		{"/health", 200, ""},
+		// the path is made absolute
+		{"health", 200, ""},
+		{"/broken", 200, "GET /broken answered 503, expected 200"},
+		{"/broken", 503, ""},
+		// redirects are not followed
+		{"/moved", 200, "GET /moved answered 302, expected 200"},
+	}
+
+	for _, test := range tests {
+		err := NewProber(time.Second, test.path, test.expected).Probe(serviceAt(t, "1", address))
+		if test.message == "" && err != nil {
+			t.Errorf("GET %s expecting %d : unexpected error %v", test.path, test.expected, err)
+		}
+		if test.message != "" && (err == nil || err.Error() != test.message) {
+			t.Errorf("GET %s expecting %d : expected %q, got %v", test.path, test.expected, test.message, err)
+		}
+	}
+}
+
+func TestProbeCluster(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	closed := closedAddress(t)
+
+	stopped := serviceAt(t, "3", closed)
+	stopped.Status = &Status{Expected: STOPPED_STATUS, Current: STOPPED_STATUS}
+	unlocated := serviceAt(t, "4", closed)
+	unlocated.Location = nil
+	unreachable := serviceAt(t, "2", closed)
+
+	p := NewProber(time.Second, "/", 200)
+	cluster := &ServiceCluster{Name: "nxio_000001", Instances: []*Service{
+		serviceAt(t, "1", strings.TrimPrefix(server.URL, "http://")), stopped, unlocated,
+	}}
+	if err := p.ProbeCluster(cluster); err != nil {
+		t.Errorf("only started and located instances should be probed, got %v", err)
+	}
+
+	cluster.Instances = append(cluster.Instances, unreachable)
+	err := p.ProbeCluster(cluster)
+	unreachableErr, ok := err.(UnreachableError)
+	if !ok {
+		t.Fatalf("expected an UnreachableError, got %#v", err)
+	}
+	if unreachableErr.Service != unreachable {
+		t.Errorf("expected instance 2 to be reported, got %s", unreachableErr.Service.Index)
+	}
+	if !strings.HasPrefix(err.Error(), "instance nxio_000001/2 at "+closed+" is unreachable : ") {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var checkDurationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// PrometheusExporter keeps the watcher metrics and serves them in the
+// Prometheus text exposition format.
+type PrometheusExporter struct {
+	lock sync.RWMutex
+
+	statusCounts map[string]int64
+	services     []serviceSample
+	transitions  map[string]uint64
+	flapping     []string
+
+	checkBucketCounts []uint64
+	checkSum          float64
+	checkCount        uint64
+}
+
+type serviceSample struct {
+	Name   string
+	Index  string
+	Host   string
+	Status string
+}
+
+func NewPrometheusExporter() *PrometheusExporter {
+	return &PrometheusExporter{
+		statusCounts:      make(map[string]int64),
+		transitions:       make(map[string]uint64),
+		checkBucketCounts: make([]uint64, len(checkDurationBuckets)),
+	}
+}
+
+func (pe *PrometheusExporter) SetStatusCounts(counts map[string]int64) {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+	pe.statusCounts = counts
+}
+
+func (pe *PrometheusExporter) SetServices(services []serviceSample) {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+	pe.services = services
+}
+
+func (pe *PrometheusExporter) SetFlapping(names []string) {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+	pe.flapping = names
+}
+
+func (pe *PrometheusExporter) IncTransition(kind string) {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+	pe.transitions[kind]++
+}
+
+func (pe *PrometheusExporter) ObserveCheck(d time.Duration) {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	seconds := d.Seconds()
+	for i, bound := range checkDurationBuckets {
+		if seconds <= bound {
+			pe.checkBucketCounts[i]++
+		}
+	}
+	pe.checkSum += seconds
+	pe.checkCount++
+}
+
+func (pe *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	pe.Render(w)
+}
+
+func (pe *PrometheusExporter) Render(w io.Writer) {
+	pe.lock.RLock()
+	defer pe.lock.RUnlock()
+
+	fmt.Fprintln(w, "# HELP arken_services Number of service clusters by computed status.")
+	fmt.Fprintln(w, "# TYPE arken_services gauge")
+	for _, status := range sortedKeys(pe.statusCounts) {
+		fmt.Fprintf(w, "arken_services{status=\"%s\"} %d\n", escapeLabel(status), pe.statusCounts[status])
+	}
+
+	fmt.Fprintln(w, "# HELP arken_service_status Computed status of each service instance, always 1.")
+	fmt.Fprintln(w, "# TYPE arken_service_status gauge")
+	for _, s := range pe.services {
+		fmt.Fprintf(w, "arken_service_status{service=\"%s\",index=\"%s\",host=\"%s\",status=\"%s\"} 1\n",
+			escapeLabel(s.Name), escapeLabel(s.Index), escapeLabel(s.Host), escapeLabel(s.Status))
+	}
+
+	fmt.Fprintln(w, "# HELP arken_cluster_transitions_total Number of error and recovery transitions.")
+	fmt.Fprintln(w, "# TYPE arken_cluster_transitions_total counter")
+	for _, kind := range []string{NotifyError, NotifyRecovery} {
+		fmt.Fprintf(w, "arken_cluster_transitions_total{kind=\"%s\"} %d\n", kind, pe.transitions[kind])
+	}
+
+	fmt.Fprintln(w, "# HELP arken_flapping_clusters Number of clusters currently flapping.")
+	fmt.Fprintln(w, "# TYPE arken_flapping_clusters gauge")
+	fmt.Fprintf(w, "arken_flapping_clusters %d\n", len(pe.flapping))
+
+	fmt.Fprintln(w, "# HELP arken_cluster_flapping Clusters currently flapping, always 1.")
+	fmt.Fprintln(w, "# TYPE arken_cluster_flapping gauge")
+	for _, name := range pe.flapping {
+		fmt.Fprintf(w, "arken_cluster_flapping{service=\"%s\"} 1\n", escapeLabel(name))
+	}
+
+	fmt.Fprintln(w, "# HELP arken_check_duration_seconds Duration of cluster checks.")
+	fmt.Fprintln(w, "# TYPE arken_check_duration_seconds histogram")
+	for i, bound := range checkDurationBuckets {
+		fmt.Fprintf(w, "arken_check_duration_seconds_bucket{le=\"%g\"} %d\n", bound, pe.checkBucketCounts[i])
+	}
+	fmt.Fprintf(w, "arken_check_duration_seconds_bucket{le=\"+Inf\"} %d\n", pe.checkCount)
+	fmt.Fprintf(w, "arken_check_duration_seconds_sum %g\n", pe.checkSum)
+	fmt.Fprintf(w, "arken_check_duration_seconds_count %d\n", pe.checkCount)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const metricsGolden = `# HELP arken_services Number of service clusters by computed status.
+# TYPE arken_services gauge
+arken_services{status="error"} 2
+arken_services{status="started"} 118
+# HELP arken_service_status Computed status of each service instance, always 1.
+# TYPE arken_service_status gauge
+arken_service_status{service="nxio_000472",index="1",host="10.0.0.12",status="started"} 1
+arken_service_status{service="we\"ird\\name\nhere",index="2",host="",status="error"} 1
+# HELP arken_cluster_transitions_total Number of error and recovery transitions.
+# TYPE arken_cluster_transitions_total counter
+arken_cluster_transitions_total{kind="error"} 2
+arken_cluster_transitions_total{kind="recovery"} 1
+# HELP arken_flapping_clusters Number of clusters currently flapping.
+# TYPE arken_flapping_clusters gauge
+arken_flapping_clusters 2
+# HELP arken_cluster_flapping Clusters currently flapping, always 1.
+# TYPE arken_cluster_flapping gauge
+arken_cluster_flapping{service="nxio_000472"} 1
+arken_cluster_flapping{service="nxio\"001538"} 1
+# HELP arken_check_duration_seconds Duration of cluster checks.
+# TYPE arken_check_duration_seconds histogram
+arken_check_duration_seconds_bucket{le="0.001"} 0
+arken_check_duration_seconds_bucket{le="0.005"} 0
+arken_check_duration_seconds_bucket{le="0.01"} 0
+arken_check_duration_seconds_bucket{le="0.05"} 0
+arken_check_duration_seconds_bucket{le="0.1"} 0
+arken_check_duration_seconds_bucket{le="0.5"} 1
+arken_check_duration_seconds_bucket{le="1"} 2
+arken_check_duration_seconds_bucket{le="5"} 2
+arken_check_duration_seconds_bucket{le="10"} 2
+arken_check_duration_seconds_bucket{le="30"} 2
+arken_check_duration_seconds_bucket{le="60"} 2
+arken_check_duration_seconds_bucket{le="+Inf"} 3
+arken_check_duration_seconds_sum 91.5
+arken_check_duration_seconds_count 3
+`
+
+func TestPrometheusRender(t *testing.T) {
+	pe := NewPrometheusExporter()
+	pe.SetStatusCounts(map[string]int64{"started": 118, "error": 2})
+	pe.SetServices([]serviceSample{
+		{Name: "nxio_000472", Index: "1", Host: "10.0.0.12", Status: "started"},
+		{Name: "we\"ird\\name\nhere", Index: "2", Status: "error"},
+	})
+	pe.IncTransition(NotifyError)
+	pe.IncTransition(NotifyError)
+	pe.IncTransition(NotifyRecovery)
+	pe.SetFlapping([]string{"nxio_000472", "nxio\"001538"})
+	// 500ms falls in the le="0.5" bucket, 90s only in +Inf
+	pe.ObserveCheck(500 * time.Millisecond)
+	pe.ObserveCheck(time.Second)
+	pe.ObserveCheck(90 * time.Second)
+
+	var buf bytes.Buffer
+	pe.Render(&buf)
+	if buf.String() != metricsGolden {
+		t.Errorf("expected :\n%s\ngot :\n%s", metricsGolden, buf.String())
+	}
+}
+
+func TestPrometheusServeHTTP(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewPrometheusExporter().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte("arken_check_duration_seconds_count 0\n")) {
+		t.Errorf("unexpected body :\n%s", rec.Body.String())
+	}
+}
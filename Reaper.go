@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
+	"github.com/golang/glog"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+// Reaper periodically passivates the started instances that have not been
+// accessed for more than IdleTime.
+type Reaper struct {
+	Watcher         *Watcher
+	Driver          drivers.ServiceDriver
+	IdleTime        time.Duration
+	Include         []string
+	Exclude         []string
+	MaxPassivations int
+	DryRun          bool
+	Interval        int
+	SingleRun       bool
+	Out             io.Writer
+}
+
+type ReaperReport struct {
+	Scanned    int
+	Idle       int
+	Passivated []*Service
+	Failed     map[*Service]error
+	Postponed  int
+}
+
+func (r *Reaper) Run(stop chan interface{}) error {
+	r.cycle()
+	if r.SingleRun {
+		return nil
+	}
+
+	ticker := time.NewTicker(time.Duration(r.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			r.cycle()
+		}
+	}
+}
+
+func (r *Reaper) cycle() *ReaperReport {
+	report := &ReaperReport{Failed: make(map[*Service]error)}
+
+	idle := r.idleServices(report)
+	sort.Sort(byLastAccess(idle))
+
+	if r.MaxPassivations > 0 && len(idle) > r.MaxPassivations {
+		report.Postponed = len(idle) - r.MaxPassivations
+		idle = idle[:r.MaxPassivations]
+	}
+
+	for _, service := range idle {
+		if r.DryRun {
+			report.Passivated = append(report.Passivated, service)
+			continue
+		}
+		if _, err := r.Driver.Passivate(service); err != nil {
+			glog.Errorf("Unable to passivate %s/%s : %v", service.Name, service.Index, err)
+			report.Failed[service] = err
+		} else {
+			report.Passivated = append(report.Passivated, service)
+		}
+	}
+
+	r.printReport(report)
+	return report
+}
+
+func (r *Reaper) idleServices(report *ReaperReport) []*Service {
+	idle := []*Service{}
+	for _, cluster := range r.Watcher.Services {
+		for _, service := range cluster.GetInstances() {
+			report.Scanned++
+
+			if !r.matches(service.Name) || service.Status == nil || service.Status.Compute() != STARTED_STATUS {
+				continue
+			}
+			if service.LastAccess == nil || time.Since(*service.LastAccess) < r.IdleTime {
+				continue
+			}
+			report.Idle++
+			idle = append(idle, service)
+		}
+	}
+	return idle
+}
+
+// matches returns true if the name matches one of the include patterns, if
+// any, and none of the exclude patterns.
+func (r *Reaper) matches(name string) bool {
+	for _, pattern := range r.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(r.Include) == 0 {
+		return true
+	}
+	for _, pattern := range r.Include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reaper) printReport(report *ReaperReport) {
+	action := "passivated"
+	if r.DryRun {
+		action = "would passivate"
+	}
+
+	fmt.Fprintf(r.Out, "%s reaper cycle : %d instances scanned, %d idle, %d %s, %d failed, %d postponed\n",
+		time.Now().Format(time.RFC3339), report.Scanned, report.Idle, len(report.Passivated), action,
+		len(report.Failed), report.Postponed)
+	for _, service := range report.Passivated {
+		fmt.Fprintf(r.Out, "  %s %s/%s (last access : %s)\n", action, service.Name, service.Index, service.LastAccess)
+	}
+	failed := make([]string, 0, len(report.Failed))
+	for service, err := range report.Failed {
+		failed = append(failed, fmt.Sprintf("  failed %s/%s : %v", service.Name, service.Index, err))
+	}
+	sort.Strings(failed)
+	for _, line := range failed {
+		fmt.Fprintln(r.Out, line)
+	}
+}
+
+type byLastAccess []*Service
+
+func (s byLastAccess) Len() int           { return len(s) }
+func (s byLastAccess) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLastAccess) Less(i, j int) bool { return s[i].LastAccess.Before(*s[j].LastAccess) }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	. "github.com/arkenio/goarken"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingDriver records the operations it is asked for, and fails those
+// on the services, given as name/index, of fail.
+type recordingDriver struct {
+	lock  sync.Mutex
+	calls []string
+	fail  map[string]error
+}
+
+func (d *recordingDriver) call(operation string, s *Service) (*Service, error) {
+	key := s.Name + "/" + s.Index
+	d.lock.Lock()
+	d.calls = append(d.calls, operation+" "+key)
+	d.lock.Unlock()
+
+	if err := d.fail[key]; err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (d *recordingDriver) operations() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]string{}, d.calls...)
+}
+
+func (d *recordingDriver) Start(s *Service) (*Service, error)     { return d.call("start", s) }
+func (d *recordingDriver) Stop(s *Service) (*Service, error)      { return d.call("stop", s) }
+func (d *recordingDriver) Passivate(s *Service) (*Service, error) { return d.call("passivate", s) }
+
+func reaperTestWatcher() *Watcher {
+	day := 24 * time.Hour
+	instance := func(name string, idle time.Duration, current string) *ServiceCluster {
+		s := &Service{Name: name, Index: "1", Status: &Status{Expected: current, Current: current, Alive: "1"}}
+		if idle > 0 {
+			lastAccess := time.Now().Add(-idle)
+			s.LastAccess = &lastAccess
+		}
+		return &ServiceCluster{Name: name, Instances: []*Service{s}}
+	}
+
+	clusters := []*ServiceCluster{
+		instance("nxio_100001", 3*day, STARTED_STATUS),
+		instance("nxio_100002", 5*day, STARTED_STATUS),
+		instance("nxio_100003", 4*day, STARTED_STATUS),
+		instance("nxio_100004", time.Hour, STARTED_STATUS), // not idle
+		instance("nxio_100005", 0, STARTED_STATUS),         // never accessed
+		instance("nxio_100006", 9*day, PASSIVATED_STATUS),  // not started
+		instance("nxio_000001", 9*day, STARTED_STATUS),     // excluded
+		instance("other_000001", 9*day, STARTED_STATUS),    // not included
+	}
+	w := &Watcher{Services: map[string]*ServiceCluster{}}
+	for _, cluster := range clusters {
+		w.Services[cluster.Name] = cluster
+	}
+	return w
+}
+
+func newTestReaper(driver *recordingDriver) (*Reaper, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &Reaper{
+		Watcher:  reaperTestWatcher(),
+		Driver:   driver,
+		IdleTime: 2 * 24 * time.Hour,
+		Include:  []string{"nxio_*"},
+		Exclude:  []string{"nxio_0000*"},
+		Out:      out,
+	}, out
+}
+
+func TestReaperPassivatesIdleServicesOldestFirst(t *testing.T) {
+	driver := &recordingDriver{}
+	r, _ := newTestReaper(driver)
+
+	report := r.cycle()
+
+	expected := []string{"passivate nxio_100002/1", "passivate nxio_100003/1", "passivate nxio_100001/1"}
+	if !reflect.DeepEqual(driver.operations(), expected) {
+		t.Errorf("expected %v, got %v", expected, driver.operations())
+	}
+	if report.Scanned != 8 || report.Idle != 3 || len(report.Passivated) != 3 || report.Postponed != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestReaperMatches(t *testing.T) {
+	r := &Reaper{Include: []string{"nxio_*", "test_*"}, Exclude: []string{"nxio_0000*"}}
+	tests := map[string]bool{
+		"nxio_100001":  true,
+		"test_1":       true,
+		"nxio_000001":  false,
+		"other_000001": false,
+	}
+	for name, expected := range tests {
+		if r.matches(name) != expected {
+			t.Errorf("%s : expected %v", name, expected)
+		}
+	}
+
+	// Without include patterns, every service not excluded matches
+	r.Include = nil
+	if !r.matches("other_000001") || r.matches("nxio_000001") {
+		t.Error("expected only the exclude patterns to apply")
+	}
+}
+
+func TestReaperMaxPassivations(t *testing.T) {
+	driver := &recordingDriver{}
+	r, _ := newTestReaper(driver)
+	r.MaxPassivations = 2
+
+	report := r.cycle()
+
+	// The oldest ones are passivated, the others postponed
+	expected := []string{"passivate nxio_100002/1", "passivate nxio_100003/1"}
+	if !reflect.DeepEqual(driver.operations(), expected) {
+		t.Errorf("expected %v, got %v", expected, driver.operations())
+	}
+	if report.Postponed != 1 {
+		t.Errorf("expected 1 postponed service, got %d", report.Postponed)
+	}
+}
+
+func TestReaperDryRun(t *testing.T) {
+	driver := &recordingDriver{}
+	r, out := newTestReaper(driver)
+	r.DryRun = true
+
+	report := r.cycle()
+
+	if len(driver.operations()) != 0 {
+		t.Errorf("expected no driver call in dry-run, got %v", driver.operations())
+	}
+	if len(report.Passivated) != 3 {
+		t.Errorf("expected 3 services reported, got %d", len(report.Passivated))
+	}
+	if !strings.Contains(out.String(), "would passivate nxio_100002/1") {
+		t.Errorf("expected the services that would be passivated :\n%s", out)
+	}
+}
+
+func TestReaperReportsFailuresInOrder(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		driver := &recordingDriver{fail: map[string]error{
+			"nxio_100001/1": errors.New("unit not found"),
+			"nxio_100002/1": errors.New("timeout"),
+			"nxio_100003/1": errors.New("conflict"),
+		}}
+		r, out := newTestReaper(driver)
+
+		report := r.cycle()
+		if len(report.Failed) != 3 || len(report.Passivated) != 0 {
+			t.Fatalf("unexpected report %+v", report)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		expected := []string{
+			"  failed nxio_100001/1 : unit not found",
+			"  failed nxio_100002/1 : timeout",
+			"  failed nxio_100003/1 : conflict",
+		}
+		if !reflect.DeepEqual(lines[1:], expected) {
+			t.Fatalf("expected the failures sorted, got :\n%s", out)
+		}
+	}
+}
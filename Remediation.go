@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/golang/glog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const NotifyRemediation = "remediation"
+
+// RemediationRule describes an action to take on the instances of a cluster
+// in error. A rule is written as :
+//
+//     <action>:<key>=<value>,<key>=<value>...
+//
+// where action is start, stop or passivate and keys are :
+//
+//     expected    : only act on instances with this expected status
+//     current     : only act on instances with this current status
+//     checks      : number of consecutive evaluations the rule must match (default 1)
+//     errorFor    : number of minutes the cluster must have been in error
+//     maxAttempts : number of times the action may be taken (default 3)
+//     backoff     : number of seconds to wait after the first attempt, doubled at each attempt (default 60)
+//
+// For instance "start:expected=started,current=stopped,checks=3" or
+// "passivate:errorFor=30,maxAttempts=1".
+type RemediationRule struct {
+	Spec        string
+	Action      string
+	Expected    string
+	Current     string
+	Checks      int
+	ErrorFor    time.Duration
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+type remediationState struct {
+	matches     int
+	attempts    int
+	nextAttempt time.Time
+	gaveUp      bool
+	// recoveredAt is set when the cluster recovers, the attempts are only
+	// forgotten once it stayed healthy for the cool-down period
+	recoveredAt time.Time
+}
+
+// DefaultRemediationCooldown is the time a cluster must stay healthy before
+// its remediation attempts are forgotten.
+const DefaultRemediationCooldown = 30 * time.Minute
+
+func ParseRemediationRule(spec string) (*RemediationRule, error) {
+	rule := &RemediationRule{
+		Spec:        spec,
+		Checks:      1,
+		MaxAttempts: 3,
+		Backoff:     60 * time.Second,
+	}
+
+	action, params := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		action, params = spec[:i], spec[i+1:]
+	}
+
+	switch action {
+	case "start", "stop", "passivate":
+		rule.Action = action
+	default:
+		return nil, fmt.Errorf("Unknown remediation action %q in %q", action, spec)
+	}
+
+	if params == "" {
+		return rule, nil
+	}
+
+	for _, param := range strings.Split(params, ",") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid remediation parameter %q in %q", param, spec)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		switch key {
+		case "expected":
+			rule.Expected = value
+		case "current":
+			rule.Current = value
+		default:
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("Invalid value for %s in %q : %s", key, spec, value)
+			}
+			switch key {
+			case "checks":
+				rule.Checks = n
+			case "errorFor":
+				rule.ErrorFor = time.Duration(n) * time.Minute
+			case "maxAttempts":
+				rule.MaxAttempts = n
+			case "backoff":
+				rule.Backoff = time.Duration(n) * time.Second
+			default:
+				return nil, fmt.Errorf("Unknown remediation parameter %q in %q", key, spec)
+			}
+		}
+	}
+	return rule, nil
+}
+
+// targets returns the instances of the cluster the rule applies to.
+func (rule *RemediationRule) targets(cluster *ServiceCluster, inErrorSince time.Time) []*Service {
+	if rule.ErrorFor > 0 && time.Since(inErrorSince) < rule.ErrorFor {
+		return nil
+	}
+
+	targets := []*Service{}
+	for _, service := range cluster.GetInstances() {
+		if service.Status == nil {
+			continue
+		}
+		if rule.Expected != "" && service.Status.Expected != rule.Expected {
+			continue
+		}
+		if rule.Current != "" && service.Status.Current != rule.Current {
+			continue
+		}
+		targets = append(targets, service)
+	}
+	return targets
+}
+
+func (cw *ClusterWatcher) remediationLoop(done chan struct{}) {
+	interval := time.Duration(cw.RemediationInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if cw.Election != nil && !cw.Election.IsLeader() {
+				continue
+			}
+			cw.expireRemediations(time.Now())
+
+			cw.lock.Lock()
+			states := make([]errorState, 0, len(cw.inError))
+			for _, state := range cw.inError {
+				states = append(states, *state)
+			}
+			cw.lock.Unlock()
+
+			for _, state := range states {
+				cw.remediate(state.Cluster, state.Since)
+			}
+		}
+	}
+}
+
+func (cw *ClusterWatcher) remediate(cluster *ServiceCluster, inErrorSince time.Time) {
+	for i, rule := range cw.Remediations {
+		targets := rule.targets(cluster, inErrorSince)
+
+		cw.lock.Lock()
+		key := fmt.Sprintf("%s/%d", cluster.Name, i)
+		state, ok := cw.remediations[key]
+		if !ok || cw.cooledDown(state, time.Now()) {
+			state = &remediationState{}
+			cw.remediations[key] = state
+		}
+		state.recoveredAt = time.Time{}
+
+		if len(targets) == 0 {
+			state.matches = 0
+			cw.lock.Unlock()
+			continue
+		}
+
+		state.matches++
+		if state.matches < rule.Checks || time.Now().Before(state.nextAttempt) {
+			cw.lock.Unlock()
+			continue
+		}
+
+		if state.attempts >= rule.MaxAttempts {
+			gaveUp, attempts := state.gaveUp, state.attempts
+			state.gaveUp = true
+			cw.lock.Unlock()
+
+			if !gaveUp {
+				n := cw.newNotification(NotifyRemediation, cluster, nil)
+				n.Title = fmt.Sprintf("Remediation %q on IO instance %s gave up after %d attempts", rule.Spec, cluster.Name, attempts)
+				n.AlertType = "error"
+				cw.Notifier.Notify(n)
+			}
+			continue
+		}
+
+		state.attempts++
+		state.nextAttempt = time.Now().Add(rule.Backoff * time.Duration(1<<uint(state.attempts-1)))
+		attempt := state.attempts
+		cw.lock.Unlock()
+
+		err := cw.runRemediation(rule, targets)
+
+		n := cw.newNotification(NotifyRemediation, cluster, err)
+		n.Title = fmt.Sprintf("Remediation %q on IO instance %s (attempt %d/%d)", rule.Spec, cluster.Name, attempt, rule.MaxAttempts)
+		n.AlertType = "warning"
+		if err != nil {
+			n.Title = n.Title + " failed"
+			n.AlertType = "error"
+		}
+		cw.Notifier.Notify(n)
+	}
+}
+
+func (cw *ClusterWatcher) runRemediation(rule *RemediationRule, targets []*Service) error {
+	for _, service := range targets {
+		glog.Infof("Remediation : %s %s/%s", rule.Action, service.Name, service.Index)
+
+		var err error
+		switch rule.Action {
+		case "start":
+			_, err = cw.Driver.Start(service)
+		case "stop":
+			_, err = cw.Driver.Stop(service)
+		case "passivate":
+			_, err = cw.Driver.Passivate(service)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to %s %s/%s : %v", rule.Action, service.Name, service.Index, err)
+		}
+	}
+	return nil
+}
+
+// recoverRemediations records that a cluster recovered. Its remediation
+// budgets are kept until it stayed healthy for the cool-down period, so that
+// a flapping cluster is not remediated without limit. It must be called with
+// the lock held.
+func (cw *ClusterWatcher) recoverRemediations(clusterName string, now time.Time) {
+	for i := range cw.Remediations {
+		if state, ok := cw.remediations[fmt.Sprintf("%s/%d", clusterName, i)]; ok {
+			state.matches = 0
+			state.recoveredAt = now
+		}
+	}
+}
+
+// cooledDown returns true if the cluster of the state stayed healthy for the
+// cool-down period.
+func (cw *ClusterWatcher) cooledDown(state *remediationState, now time.Time) bool {
+	return !state.recoveredAt.IsZero() && now.Sub(state.recoveredAt) >= cw.remediationCooldown()
+}
+
+func (cw *ClusterWatcher) remediationCooldown() time.Duration {
+	if cw.RemediationCooldown <= 0 {
+		return DefaultRemediationCooldown
+	}
+	return cw.RemediationCooldown
+}
+
+// expireRemediations forgets the budgets of the clusters that stayed healthy
+// for the cool-down period.
+func (cw *ClusterWatcher) expireRemediations(now time.Time) {
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+
+	for key, state := range cw.remediations {
+		if cw.cooledDown(state, now) {
+			delete(cw.remediations, key)
+		}
+	}
+}
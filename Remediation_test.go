@@ -0,0 +1,103 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingDriver fails its first failures calls with err, after sleeping
+// delay on each call.
+type countingDriver struct {
+	calls    int32
+	failures int32
+	err      error
+	delay    time.Duration
+}
+
+func (d *countingDriver) call(s *Service) (*Service, error) {
+	time.Sleep(d.delay)
+	if atomic.AddInt32(&d.calls, 1) <= d.failures {
+		return nil, d.err
+	}
+	return s, nil
+}
+
+func (d *countingDriver) Start(s *Service) (*Service, error)     { return d.call(s) }
+func (d *countingDriver) Stop(s *Service) (*Service, error)      { return d.call(s) }
+func (d *countingDriver) Passivate(s *Service) (*Service, error) { return d.call(s) }
+
+type recordingNotifier struct {
+	notifications []*Notification
+}
+
+func (rn *recordingNotifier) Notify(n *Notification) error {
+	rn.notifications = append(rn.notifications, n)
+	return nil
+}
+
+func newRemediationWatcher(t *testing.T, spec string, driver *countingDriver) *ClusterWatcher {
+	rule, err := ParseRemediationRule(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ClusterWatcher{
+		Notifier:     &recordingNotifier{},
+		Driver:       driver,
+		Remediations: []*RemediationRule{rule},
+		remediations: make(map[string]*remediationState),
+	}
+}
+
+func stoppedCluster() *ServiceCluster {
+	return &ServiceCluster{Name: "nxio_000001", Instances: []*Service{{
+		Name:   "nxio_000001",
+		Index:  "1",
+		Status: &Status{Expected: STARTED_STATUS, Current: STOPPED_STATUS},
+	}}}
+}
+
+func TestRemediationBudgetSurvivesFlapping(t *testing.T) {
+	driver := &countingDriver{}
+	cw := newRemediationWatcher(t, "start:expected=started,current=stopped,maxAttempts=2,backoff=0", driver)
+	cluster := stoppedCluster()
+
+	// The cluster recovers after each attempt, then fails again
+	for i := 0; i < 5; i++ {
+		cw.remediate(cluster, time.Now())
+		cw.lock.Lock()
+		cw.recoverRemediations(cluster.Name, time.Now())
+		cw.lock.Unlock()
+	}
+
+	if driver.calls != 2 {
+		t.Errorf("expected 2 remediations while flapping, got %d", driver.calls)
+	}
+}
+
+func TestRemediationBudgetResetAfterCooldown(t *testing.T) {
+	driver := &countingDriver{}
+	cw := newRemediationWatcher(t, "start:expected=started,current=stopped,maxAttempts=1,backoff=0", driver)
+	cw.RemediationCooldown = time.Minute
+	cluster := stoppedCluster()
+
+	cw.remediate(cluster, time.Now())
+	cw.remediate(cluster, time.Now())
+	if driver.calls != 1 {
+		t.Fatalf("expected 1 remediation, got %d", driver.calls)
+	}
+
+	cw.lock.Lock()
+	cw.recoverRemediations(cluster.Name, time.Now().Add(-2*time.Minute))
+	cw.lock.Unlock()
+	cw.expireRemediations(time.Now())
+	if len(cw.remediations) != 0 {
+		t.Errorf("expected the budget to be forgotten after the cool-down")
+	}
+
+	cw.remediate(cluster, time.Now())
+	if driver.calls != 2 {
+		t.Errorf("expected a new remediation after the cool-down, got %d calls", driver.calls)
+	}
+}
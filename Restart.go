@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/arkenio/goarken/drivers"
+	"github.com/codegangsta/cli"
+	"io"
+	"os"
+	"time"
+)
+
+// RollingRestart restarts instances one at a time : an instance is stopped,
+// started, and must be started again (and pass the probe if any) before the
+// next one is restarted. The roll is aborted at the first failure.
+type RollingRestart struct {
+	Driver drivers.ServiceDriver
+	// Waiter is nil in dry-run mode, the driver calls are then not waited
+	Waiter *StatusWaiter
+	Prober *Prober
+	// ProbeInterval is the time between two probes of a restarted instance,
+	// one second if not set
+	ProbeInterval time.Duration
+	Out           io.Writer
+}
+
+// Run restarts the services in order and returns the result for each
+// instance restarted. The last result is the failed one if the roll was
+// aborted.
+func (rr *RollingRestart) Run(services []*Service) []*BulkResult {
+	results := []*BulkResult{}
+	for i, service := range services {
+		fmt.Fprintf(rr.Out, "Restarting %s/%s (%d/%d)\n", service.Name, service.Index, i+1, len(services))
+
+		result := runOne(service, rr.Restart)
+		results = append(results, result)
+		if result.Err != nil {
+			fmt.Fprintf(rr.Out, "Restart of %s/%s failed, aborting : %v\n", service.Name, service.Index, result.Err)
+			break
+		}
+	}
+	return results
+}
+
+func (rr *RollingRestart) Restart(service *Service) (*Service, error) {
+	stop, start := ServiceAction(rr.Driver.Stop), ServiceAction(rr.Driver.Start)
+	if rr.Waiter != nil {
+		stop = rr.Waiter.After(stop, STOPPED_STATUS)
+		start = rr.Waiter.After(start, STARTED_STATUS)
+	}
+
+	stopped, err := stop(service)
+	if err != nil {
+		return stopped, fmt.Errorf("unable to stop : %v", err)
+	}
+	if stopped == nil {
+		stopped = service
+	}
+
+	started, err := start(stopped)
+	if err != nil {
+		return started, fmt.Errorf("unable to start : %v", err)
+	}
+	if started == nil {
+		started = stopped
+	}
+
+	if rr.Prober != nil && rr.Waiter != nil {
+		if err := rr.probe(started); err != nil {
+			return started, UnreachableError{Service: started, Err: err}
+		}
+	}
+	return started, nil
+}
+
+// probe probes the instance until it answers, as the application may need
+// some time to listen once started. It gives up after the wait timeout.
+func (rr *RollingRestart) probe(service *Service) error {
+	if service.Location == nil {
+		return fmt.Errorf("no location to probe")
+	}
+
+	interval := rr.ProbeInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	deadline := time.Now().Add(rr.Waiter.Timeout)
+	for {
+		err := rr.Prober.Probe(service)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// restartFlags are the flags of the restart commands.
+func restartFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.IntFlag{
+			Name:  "timeout",
+			Value: 300,
+			Usage: "Time to wait for each instance to be stopped, then started, in seconds",
+		},
+		cli.BoolFlag{
+			Name:  "probe",
+			Usage: "Check that each instance accepts connections on its location before restarting the next one",
+		},
+		cli.IntFlag{
+			Name:  "probeTimeout",
+			Value: 5,
+			Usage: "Number of seconds before a probe fails",
+		},
+		cli.StringFlag{
+			Name:  "probeHttpPath",
+			Value: "",
+			Usage: "If set, probes also GET this path on the instance location",
+		},
+		cli.IntFlag{
+			Name:  "probeHttpStatus",
+			Value: 200,
+			Usage: "HTTP status expected when probing probeHttpPath",
+		},
+	}
+}
+
+// runRestart restarts the services once confirmed, and prints the result
+// for each instance restarted.
+func runRestart(c *cli.Context, client WaitClient, driver drivers.ServiceDriver, services []*Service) error {
+	if len(services) == 0 {
+		fmt.Fprintln(os.Stderr, "No service selected")
+		return nil
+	}
+
+	sortServices(services)
+	if err := confirmAction(c, "restart", services); err != nil {
+		return err
+	}
+
+	rr := &RollingRestart{Driver: driver, Out: os.Stderr}
+	if !c.GlobalBool("dryRun") {
+		rr.Waiter = newStatusWaiter(c, client)
+	}
+	if c.Bool("probe") {
+		rr.Prober = NewProber(time.Duration(c.Int("probeTimeout"))*time.Second,
+			c.String("probeHttpPath"), c.Int("probeHttpStatus"))
+	}
+
+	results := rr.Run(services)
+	printBulkResults(os.Stdout, "restart", results)
+
+	if last := results[len(results)-1]; last.Err != nil {
+		return &ExitError{Code: 1, Message: fmt.Sprintf("Restart aborted, %d of %d instances not restarted",
+			len(services)-len(results)+1, len(services))}
+	}
+	return nil
+}
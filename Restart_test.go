@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	. "github.com/arkenio/goarken"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// statusDriver records the calls and writes the status they lead to in
+// etcd, as the schedulers do.
+type statusDriver struct {
+	recordingDriver
+	client *fakeWaitClient
+}
+
+func (d *statusDriver) setStatus(s *Service, status, alive string) {
+	d.client.set(s.NodeKey+"/status/expected", status)
+	d.client.set(s.NodeKey+"/status/alive", alive)
+	d.client.set(s.NodeKey+"/status/current", status)
+}
+
+func (d *statusDriver) Start(s *Service) (*Service, error) {
+	if _, err := d.call("start", s); err != nil {
+		return nil, err
+	}
+	d.setStatus(s, STARTED_STATUS, "1")
+	return s, nil
+}
+
+func (d *statusDriver) Stop(s *Service) (*Service, error) {
+	if _, err := d.call("stop", s); err != nil {
+		return nil, err
+	}
+	d.setStatus(s, STOPPED_STATUS, "")
+	return s, nil
+}
+
+func restartServices(count int) []*Service {
+	services := []*Service{}
+	for _, index := range []string{"1", "2", "3"}[:count] {
+		services = append(services, &Service{Name: "nxio_000001", Index: index, NodeKey: "/services/nxio_000001/" + index})
+	}
+	return services
+}
+
+func TestRollingRestartStopsAtFirstFailure(t *testing.T) {
+	tests := []struct {
+		fail       map[string]error
+		operations []string
+		message    string
+	}{
+		{nil, []string{
+			"stop nxio_000001/1", "start nxio_000001/1",
+			"stop nxio_000001/2", "start nxio_000001/2",
+			"stop nxio_000001/3", "start nxio_000001/3",
+		}, ""},
+		{map[string]error{"nxio_000001/2": errors.New("unit not found")}, []string{
+			"stop nxio_000001/1", "start nxio_000001/1",
+			"stop nxio_000001/2",
+		}, "unable to stop : unit not found"},
+	}
+
+	for _, test := range tests {
+		driver := &recordingDriver{fail: test.fail}
+		rr := &RollingRestart{Driver: driver, Out: ioutil.Discard}
+		results := rr.Run(restartServices(3))
+
+		if operations := driver.operations(); !reflect.DeepEqual(operations, test.operations) {
+			t.Errorf("expected %v, got %v", test.operations, operations)
+		}
+		last := results[len(results)-1]
+		if test.message == "" {
+			if len(results) != 3 || last.Err != nil {
+				t.Errorf("expected 3 instances restarted, got %d, last error %v", len(results), last.Err)
+			}
+			continue
+		}
+		if len(results) != 2 || last.Err == nil || last.Err.Error() != test.message {
+			t.Errorf("expected the roll to stop on instance 2 with %q, got %d results, last error %v",
+				test.message, len(results), last.Err)
+		}
+	}
+}
+
+func TestRollingRestartWaitsForEachInstance(t *testing.T) {
+	client := newFakeWaitClient(map[string]string{})
+	driver := &statusDriver{client: client}
+	rr := &RollingRestart{
+		Driver: driver,
+		Waiter: newTestWaiter(client, time.Second, time.Second),
+		Out:    ioutil.Discard,
+	}
+
+	results := rr.Run(restartServices(2))
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.Err != nil || result.After != STARTED_STATUS {
+			t.Errorf("expected %s/%s to be started, got %+v", result.Service.Name, result.Service.Index, result)
+		}
+	}
+}
+
+// flakyServer answers 503 to the first failures requests, then 200.
+func flakyServer(failures int) (*httptest.Server, func() int) {
+	var lock sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		n := requests
+		lock.Unlock()
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	return server, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests
+	}
+}
+
+func probedRestart(t *testing.T, server *httptest.Server, timeout time.Duration) (*RollingRestart, *Service) {
+	client := newFakeWaitClient(map[string]string{})
+	service := serviceAt(t, "1", strings.TrimPrefix(server.URL, "http://"))
+	service.NodeKey = "/services/nxio_000001/1"
+	return &RollingRestart{
+		Driver:        &statusDriver{client: client},
+		Waiter:        newTestWaiter(client, timeout, time.Second),
+		Prober:        NewProber(time.Second, "/", 200),
+		ProbeInterval: 10 * time.Millisecond,
+		Out:           ioutil.Discard,
+	}, service
+}
+
+func TestRollingRestartRetriesTheProbe(t *testing.T) {
+	server, requests := flakyServer(3)
+	defer server.Close()
+	rr, service := probedRestart(t, server, time.Second)
+
+	if _, err := rr.Restart(service); err != nil {
+		t.Fatalf("expected the instance to pass the probe once listening, got %v", err)
+	}
+	if n := requests(); n != 4 {
+		t.Errorf("expected 4 probes, got %d", n)
+	}
+}
+
+func TestRollingRestartProbeTimeout(t *testing.T) {
+	server, requests := flakyServer(1000)
+	defer server.Close()
+	rr, service := probedRestart(t, server, 100*time.Millisecond)
+
+	start := time.Now()
+	results := rr.Run([]*Service{service, serviceAt(t, "2", "127.0.0.1:1")})
+	if _, ok := results[0].Err.(UnreachableError); !ok {
+		t.Fatalf("expected an UnreachableError, got %#v", results[0].Err)
+	}
+	if len(results) != 1 {
+		t.Errorf("expected the roll to stop after the unreachable instance, got %d results", len(results))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the probe to give up after the timeout, took %v", elapsed)
+	}
+	if n := requests(); n < 2 {
+		t.Errorf("expected the probe to be retried until the timeout, got %d probes", n)
+	}
+
+	service.Location = nil
+	if _, err := rr.Restart(service); err == nil || !strings.Contains(err.Error(), "no location to probe") {
+		t.Errorf("expected an error without location, got %v", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/coreos/go-etcd/etcd"
 	"io"
 	"os"
+	"sort"
 	"strings"
 	"text/tabwriter"
 	"text/template"
@@ -23,51 +24,118 @@ type ServiceCommand struct {
 
 func (sc *ServiceCommand) getServiceCluster() (*ServiceCluster, error) {
 	if len(sc.Cli.Args()) > 0 {
-		serviceName := sc.Cli.Args()[0]
+		serviceName, index, err := sc.parseServiceArg(sc.Cli.Args()[0])
+		if err != nil {
+			return nil, err
+		}
 		path := sc.Cli.GlobalString("serviceDir") + "/" + serviceName
-		return GetServiceClusterFromPath(path, sc.Client)
+		cluster, err := GetServiceClusterFromPath(path, sc.Client)
+		if err != nil || index == "" {
+			return cluster, err
+		}
+
+		instances, err := selectIndex(cluster, index)
+		if err != nil {
+			return nil, err
+		}
+		return &ServiceCluster{Name: cluster.Name, Instances: instances}, nil
 	} else {
 		return nil, errors.New("You must pass the service name as an argument")
 	}
 
 }
 
+// parseServiceArg splits a service argument written name or name/index. The
+// index may also be given with --index.
+func (sc *ServiceCommand) parseServiceArg(arg string) (string, string, error) {
+	name, index := arg, sc.Cli.String("index")
+	if i := strings.Index(arg, "/"); i >= 0 {
+		name = arg[:i]
+		if index != "" && index != arg[i+1:] {
+			return "", "", fmt.Errorf("Index %s of %s does not match --index %s", arg[i+1:], arg, index)
+		}
+		index = arg[i+1:]
+		if index == "" {
+			return "", "", fmt.Errorf("Missing index in %s", arg)
+		}
+	}
+	return name, index, nil
+}
+
+// selectIndex returns the instance of the cluster with the given index, or an
+// error if the cluster directory has no such index.
+func selectIndex(cluster *ServiceCluster, index string) ([]*Service, error) {
+	indexes := []string{}
+	for _, service := range cluster.GetInstances() {
+		if service.Index == index {
+			return []*Service{service}, nil
+		}
+		indexes = append(indexes, service.Index)
+	}
+	sort.Strings(indexes)
+	return nil, fmt.Errorf("Service %s has no instance %s, existing indexes are : %s",
+		cluster.Name, index, strings.Join(indexes, ", "))
+}
+
+// getFilter returns the filter given with --filter, or nil.
+func (sc *ServiceCommand) getFilter() (*Filter, error) {
+	if expression := sc.Cli.String("filter"); expression != "" {
+		return ParseFilter(expression)
+	}
+	return nil, nil
+}
+
 func (sc *ServiceCommand) List(stop chan interface{}) error {
 
 	statusFilter := sc.Cli.String("status")
+	index := sc.Cli.String("index")
+	filter, err := sc.getFilter()
+	if err != nil {
+		return err
+	}
 
 	tpl := sc.Cli.String("template")
+	output := sc.Cli.String("output")
+	if err := checkOutputFormat(output); err != nil {
+		return err
+	}
+
+	services := []*Service{}
+	for _, cluster := range sc.Watcher.Services {
+		for _, service := range cluster.GetInstances() {
+			if (statusFilter == "" || statusFilter == service.Status.Compute()) &&
+				(index == "" || index == service.Index) && filter.Match(service) {
+				services = append(services, service)
+			}
+		}
+	}
+	sortServices(services)
+
+	if isStructuredOutput(output) {
+		return writeOutput(output, NewServiceOutputs(services), os.Stdout)
+	}
 
 	if tpl == "" {
 		w := new(tabwriter.Writer)
 		w.Init(os.Stdout, 0, 8, 2, '\t', 0)
 		fmt.Fprintln(w, "Name\tIndex\tDomain\tStatus\tLastAccess")
 		fmt.Fprintln(w, "----\t-----\t------\t------\t----------")
-		for _, cluster := range sc.Watcher.Services {
-			for _, service := range cluster.GetInstances() {
-
-				if statusFilter == "" || statusFilter == service.Status.Compute() {
-					fmt.Fprintln(w, strings.Join([]string{
-						service.Name,
-						service.Index,
-						service.Domain,
-						service.Status.Compute(),
-						fmt.Sprintf("%s", service.LastAccess),
-					}, "\t"))
-				}
-			}
+		for _, service := range services {
+			fmt.Fprintln(w, strings.Join([]string{
+				service.Name,
+				service.Index,
+				service.Domain,
+				service.Status.Compute(),
+				fmt.Sprintf("%s", service.LastAccess),
+			}, "\t"))
 		}
 		fmt.Fprintln(w)
 		w.Flush()
 	} else {
 		t := template.Must(template.New("service").Parse(tpl))
-		for _, cluster := range sc.Watcher.Services {
-			for _, service := range cluster.GetInstances() {
-				if statusFilter == "" || statusFilter == service.Status.Compute() {
-					t.Execute(os.Stdout, service)
-					fmt.Fprintln(os.Stdout, "")
-				}
-			}
+		for _, service := range services {
+			t.Execute(os.Stdout, service)
+			fmt.Fprintln(os.Stdout, "")
 		}
 	}
 
@@ -75,9 +143,26 @@ func (sc *ServiceCommand) List(stop chan interface{}) error {
 }
 
 func (sc *ServiceCommand) Cat(stop chan interface{}) error {
+	output := sc.Cli.String("output")
+	if err := checkOutputFormat(output); err != nil {
+		return err
+	}
+
+	filter, err := sc.getFilter()
+	if err != nil {
+		return err
+	}
+
 	cluster, err := sc.getServiceCluster()
 	if err != nil {
 		return err
+	}
+	if filter != nil {
+		cluster = &ServiceCluster{Name: cluster.Name, Instances: filter.FilterServices(cluster.GetInstances())}
+	}
+
+	if isStructuredOutput(output) {
+		return writeOutput(output, NewServiceOutputs(cluster.GetInstances()), os.Stdout)
 	} else {
 		tpl := sc.Cli.String("template")
 		renderService(cluster, tpl, os.Stdout)
@@ -86,51 +171,92 @@ func (sc *ServiceCommand) Cat(stop chan interface{}) error {
 }
 
 func (sc *ServiceCommand) Start(stop chan interface{}) error {
-	cluster, err := sc.getServiceCluster()
+	return sc.bulk("start", sc.Driver.Start)
+}
+
+func (sc *ServiceCommand) Stop(stop chan interface{}) error {
+	return sc.bulk("stop", sc.Driver.Stop)
+}
+
+func (sc *ServiceCommand) Passivate(stop chan interface{}) error {
+	return sc.bulk("passivate", sc.Driver.Passivate)
+}
+
+func (sc *ServiceCommand) Restart(stop chan interface{}) error {
+	services, err := sc.getServices()
 	if err != nil {
 		return err
 	}
 
-	for _, service := range cluster.GetInstances() {
-		service, err = sc.Driver.Start(service)
-		if err != nil {
-			break
-		}
-	}
-
-	return err
+	return runRestart(sc.Cli, sc.Client, sc.Driver, services)
 }
 
-func (sc *ServiceCommand) Stop(stop chan interface{}) error {
-	cluster, err := sc.getServiceCluster()
+// getServices returns the instances of the services given as arguments or,
+// without argument, of all the services of the cluster. Instances are then
+// selected with --status and --filter.
+func (sc *ServiceCommand) getServices() ([]*Service, error) {
+	statusFilter := sc.Cli.String("status")
+	filter, err := sc.getFilter()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, service := range cluster.GetInstances() {
-		service, err = sc.Driver.Stop(service)
-		if err != nil {
-			break
+	services := []*Service{}
+	if len(sc.Cli.Args()) > 0 {
+		for _, arg := range sc.Cli.Args() {
+			serviceName, index, err := sc.parseServiceArg(arg)
+			if err != nil {
+				return nil, err
+			}
+			path := sc.Cli.GlobalString("serviceDir") + "/" + serviceName
+			cluster, err := GetServiceClusterFromPath(path, sc.Client)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to get service %s : %v", serviceName, err)
+			}
+			if index == "" {
+				services = append(services, cluster.GetInstances()...)
+				continue
+			}
+
+			instances, err := selectIndex(cluster, index)
+			if err != nil {
+				return nil, err
+			}
+			services = append(services, instances...)
+		}
+	} else if statusFilter != "" || filter != nil {
+		if sc.Watcher == nil {
+			sc.Watcher = CreateWatcherFromCli(sc.Cli, sc.Client)
+		}
+		index := sc.Cli.String("index")
+		for _, cluster := range sc.Watcher.Services {
+			for _, service := range cluster.GetInstances() {
+				if index == "" || index == service.Index {
+					services = append(services, service)
+				}
+			}
 		}
+		sortServices(services)
+	} else {
+		return nil, errors.New("You must pass the service names as arguments, or select them with --status or --filter")
 	}
 
-	return err
+	selected := []*Service{}
+	for _, service := range filter.FilterServices(services) {
+		if statusFilter == "" || statusFilter == statusOf(service) {
+			selected = append(selected, service)
+		}
+	}
+	return selected, nil
 }
 
-func (sc *ServiceCommand) Passivate(stop chan interface{}) error {
-	cluster, err := sc.getServiceCluster()
+func (sc *ServiceCommand) bulk(action string, serviceAction ServiceAction) error {
+	services, err := sc.getServices()
 	if err != nil {
 		return err
 	}
 
-	for _, service := range cluster.GetInstances() {
-		service, err = sc.Driver.Passivate(service)
-		if err != nil {
-			break
-		}
-	}
-
-	return err
+	return runAction(sc.Cli, action, services, sc.Cli.Int("parallel"), waitFor(sc.Cli, sc.Client, action, serviceAction))
 }
 
 func renderService(cluster *ServiceCluster, tpl string, wr io.Writer) {
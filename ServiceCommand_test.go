@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	. "github.com/arkenio/goarken"
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// runServiceCommand runs fn with a service command parsing args as the
+// service subcommands do.
+func runServiceCommand(t *testing.T, watcher *Watcher, args []string, fn func(sc *ServiceCommand)) {
+	ran := false
+	app := cli.NewApp()
+	app.Flags = GetGlobalFlags()
+	app.Commands = []cli.Command{{
+		Name: "service",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "index"},
+			cli.StringFlag{Name: "status"},
+			cli.StringFlag{Name: "filter"},
+			cli.StringFlag{Name: "template"},
+			cli.StringFlag{Name: "output"},
+		},
+		Action: func(c *cli.Context) {
+			ran = true
+			fn(&ServiceCommand{Watcher: watcher, Cli: c})
+		},
+	}}
+	if err := app.Run(append([]string{progname, "service"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Fatalf("%v : the command did not run", args)
+	}
+}
+
+// captureStdout returns what fn writes to the standard output.
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		done <- data
+	}()
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+func TestParseServiceArg(t *testing.T) {
+	tests := []struct {
+		args    []string
+		name    string
+		index   string
+		message string
+	}{
+		{[]string{"nxio_000001"}, "nxio_000001", "", ""},
+		{[]string{"nxio_000001/2"}, "nxio_000001", "2", ""},
+		{[]string{"--index", "2", "nxio_000001"}, "nxio_000001", "2", ""},
+		{[]string{"--index=2", "nxio_000001/2"}, "nxio_000001", "2", ""},
+		{[]string{"--index", "3", "nxio_000001/2"}, "", "", "Index 2 of nxio_000001/2 does not match --index 3"},
+		{[]string{"nxio_000001/"}, "", "", "Missing index in nxio_000001/"},
+	}
+
+	for _, test := range tests {
+		runServiceCommand(t, nil, test.args, func(sc *ServiceCommand) {
+			name, index, err := sc.parseServiceArg(sc.Cli.Args()[0])
+			if test.message != "" {
+				if err == nil || err.Error() != test.message {
+					t.Errorf("%v : expected %q, got %v", test.args, test.message, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v : unexpected error %v", test.args, err)
+			}
+			if name != test.name || index != test.index {
+				t.Errorf("%v : expected %s and index %q, got %s and index %q", test.args, test.name, test.index, name, index)
+			}
+		})
+	}
+}
+
+func TestSelectIndex(t *testing.T) {
+	cluster := &ServiceCluster{Name: "nxio_000001", Instances: []*Service{
+		{Name: "nxio_000001", Index: "2"},
+		{Name: "nxio_000001", Index: "1"},
+	}}
+
+	instances, err := selectIndex(cluster, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0] != cluster.Instances[1] {
+		t.Errorf("expected instance 1, got %v", instances)
+	}
+
+	_, err = selectIndex(cluster, "3")
+	expected := "Service nxio_000001 has no instance 3, existing indexes are : 1, 2"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
+
+func TestServiceListIndex(t *testing.T) {
+	watcher := &Watcher{Services: map[string]*ServiceCluster{}}
+	for _, name := range []string{"nxio_000002", "nxio_000001"} {
+		cluster := &ServiceCluster{Name: name}
+		for _, index := range []string{"1", "2"} {
+			cluster.Instances = append(cluster.Instances, &Service{
+				Name:   name,
+				Index:  index,
+				Status: &Status{Expected: STARTED_STATUS, Current: STARTED_STATUS, Alive: "1"},
+			})
+		}
+		watcher.Services[name] = cluster
+	}
+
+	var err error
+	out := captureStdout(t, func() {
+		runServiceCommand(t, watcher, []string{"--index", "2", "--output", "json"}, func(sc *ServiceCommand) {
+			err = sc.List(nil)
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := []*ServiceOutput{}
+	if err := json.Unmarshal([]byte(out), &services); err != nil {
+		t.Fatalf("invalid output %q : %v", out, err)
+	}
+	if len(services) != 2 ||
+		services[0].Name != "nxio_000001" || services[0].Index != "2" ||
+		services[1].Name != "nxio_000002" || services[1].Index != "2" {
+		t.Errorf("expected instance 2 of both services, got %s", out)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"net/http"
+	"time"
+)
+
+// SlackNotifier posts notifications to a Slack or Mattermost incoming
+// webhook, with one attachment per instance of the cluster.
+type SlackNotifier struct {
+	URL      string
+	Username string
+	Client   *http.Client
+}
+
+type slackMessage struct {
+	Username    string            `json:"username,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Fallback  string       `json:"fallback"`
+	Color     string       `json:"color"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Fields    []slackField `json:"fields"`
+	Timestamp int64        `json:"ts"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{
+		URL:      url,
+		Username: progname,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (sn *SlackNotifier) Notify(n *Notification) error {
+	body, err := json.Marshal(sn.message(n))
+	if err != nil {
+		return err
+	}
+	return postJSON(sn.Client, sn.URL, body)
+}
+
+func (sn *SlackNotifier) message(n *Notification) *slackMessage {
+	msg := &slackMessage{
+		Username: sn.Username,
+		Text:     n.Title,
+	}
+	if n.Error != "" {
+		msg.Text = fmt.Sprintf("%s : `%s`", n.Title, n.Error)
+	}
+
+	if n.ServiceCluster == nil {
+		return msg
+	}
+
+	for _, service := range n.ServiceCluster.GetInstances() {
+		attachment := slackAttachment{
+			Fallback:  fmt.Sprintf("%s (%s) : %s", service.Name, service.Index, statusOf(service)),
+			Color:     slackColor(n, service),
+			Title:     fmt.Sprintf("Instance : %s", service.Name),
+			Timestamp: n.Time.Unix(),
+			Fields: []slackField{
+				{Title: "Name", Value: service.Name, Short: true},
+				{Title: "UnitName", Value: service.UnitName, Short: true},
+				{Title: "Location", Value: locationOf(service), Short: true},
+				{Title: "Domain", Value: service.Domain, Short: true},
+				{Title: "Status", Value: statusDetailOf(service), Short: false},
+			},
+		}
+		if service.Domain != "" {
+			attachment.TitleLink = fmt.Sprintf("https://%s/", service.Domain)
+		}
+		msg.Attachments = append(msg.Attachments, attachment)
+	}
+	return msg
+}
+
+func slackColor(n *Notification, service *Service) string {
+	if n.Kind == NotifyRecovery {
+		return "good"
+	}
+	switch statusOf(service) {
+	case STARTED_STATUS:
+		return "good"
+	case WARNING_STATUS, STARTING_STATUS, STOPPING_STATUS:
+		return "warning"
+	default:
+		return "danger"
+	}
+}
+
+func statusOf(service *Service) string {
+	if service.Status == nil {
+		return ""
+	}
+	return service.Status.Compute()
+}
+
+func statusDetailOf(service *Service) string {
+	if service.Status == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (expected : %s, current : %s, alive : %s)",
+		service.Status.Compute(), service.Status.Expected, service.Status.Current, service.Status.Alive)
+}
+
+func locationOf(service *Service) string {
+	if service.Location == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", service.Location.Host, service.Location.Port)
+}
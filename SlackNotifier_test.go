@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	. "github.com/arkenio/goarken"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slackStub records the messages posted to a fake incoming webhook.
+func slackStub(t *testing.T, messages *[]slackMessage) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected a JSON payload, got %q", ct)
+		}
+		msg := slackMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("invalid payload : %v", err)
+		}
+		*messages = append(*messages, msg)
+		w.Write([]byte("ok"))
+	}))
+}
+
+func slackTestNotification(kind string) *Notification {
+	cluster := &ServiceCluster{Name: "nxio_000001", Instances: []*Service{
+		{Name: "nxio_000001", Index: "1", Domain: "nxio-000001.example.com",
+			Status: &Status{Expected: STARTED_STATUS, Current: STARTED_STATUS, Alive: "1"}},
+		{Name: "nxio_000001", Index: "2", Domain: "nxio-000001.example.com",
+			Status: &Status{Expected: STARTED_STATUS, Current: STARTING_STATUS}},
+		{Name: "nxio_000001", Index: "3",
+			Status: &Status{Expected: STARTED_STATUS, Current: STOPPED_STATUS}},
+	}}
+	return &Notification{
+		Kind:           kind,
+		Cluster:        cluster.Name,
+		Title:          "nxio_000001 is in error",
+		Error:          "instance 3 is stopped",
+		Time:           time.Unix(1500000000, 0),
+		ServiceCluster: cluster,
+	}
+}
+
+func TestSlackNotifierPayload(t *testing.T) {
+	messages := []slackMessage{}
+	server := slackStub(t, &messages)
+	defer server.Close()
+
+	if err := NewSlackNotifier(server.URL).Notify(slackTestNotification(NotifyError)); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+
+	msg := messages[0]
+	if msg.Text != "nxio_000001 is in error : `instance 3 is stopped`" {
+		t.Errorf("unexpected text %q", msg.Text)
+	}
+	if len(msg.Attachments) != 3 {
+		t.Fatalf("expected one attachment per instance, got %d", len(msg.Attachments))
+	}
+
+	expected := []struct {
+		color, titleLink string
+	}{
+		{"good", "https://nxio-000001.example.com/"},
+		{"warning", "https://nxio-000001.example.com/"},
+		{"danger", ""},
+	}
+	for i, e := range expected {
+		attachment := msg.Attachments[i]
+		if attachment.Color != e.color {
+			t.Errorf("attachment %d : expected color %s, got %s", i, e.color, attachment.Color)
+		}
+		if attachment.TitleLink != e.titleLink {
+			t.Errorf("attachment %d : expected title_link %q, got %q", i, e.titleLink, attachment.TitleLink)
+		}
+		if attachment.Timestamp != 1500000000 {
+			t.Errorf("attachment %d : unexpected ts %d", i, attachment.Timestamp)
+		}
+	}
+}
+
+func TestSlackNotifierRecoveryIsGood(t *testing.T) {
+	messages := []slackMessage{}
+	server := slackStub(t, &messages)
+	defer server.Close()
+
+	if err := NewSlackNotifier(server.URL).Notify(slackTestNotification(NotifyRecovery)); err != nil {
+		t.Fatal(err)
+	}
+	for i, attachment := range messages[0].Attachments {
+		if attachment.Color != "good" {
+			t.Errorf("attachment %d : expected a recovery to be good, got %s", i, attachment.Color)
+		}
+	}
+}
+
+func TestSlackNotifierHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if err := NewSlackNotifier(server.URL).Notify(slackTestNotification(NotifyError)); err == nil {
+		t.Error("expected an error when the webhook answers 403")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PersistedError is the persisted form of the error state of a cluster.
+type PersistedError struct {
+	Since     time.Time `json:"since"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// StateStore persists the clusters in error across restarts of the watcher.
+type StateStore interface {
+	Load() (map[string]*PersistedError, error)
+	Save(state map[string]*PersistedError) error
+}
+
+type FileStateStore struct {
+	Path string
+}
+
+func (fs *FileStateStore) Load() (map[string]*PersistedError, error) {
+	data, err := ioutil.ReadFile(fs.Path)
+	if os.IsNotExist(err) {
+		return map[string]*PersistedError{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeState(data)
+}
+
+func (fs *FileStateStore) Save(state map[string]*PersistedError) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fs.Path), filepath.Base(fs.Path))
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.Path)
+}
+
+// StateClient is the part of the etcd client used by EtcdStateStore.
+type StateClient interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key string, value string, ttl uint64) (*etcd.Response, error)
+}
+
+type EtcdStateStore struct {
+	Client StateClient
+	Key    string
+}
+
+func (es *EtcdStateStore) Load() (map[string]*PersistedError, error) {
+	resp, err := es.Client.Get(es.Key, false, false)
+	if err != nil {
+		if etcdErr, ok := err.(*etcd.EtcdError); ok && etcdErr.ErrorCode == 100 {
+			return map[string]*PersistedError{}, nil
+		}
+		return nil, err
+	}
+	return decodeState([]byte(resp.Node.Value))
+}
+
+func (es *EtcdStateStore) Save(state map[string]*PersistedError) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = es.Client.Set(es.Key, string(data), 0)
+	return err
+}
+
+func decodeState(data []byte) (map[string]*PersistedError, error) {
+	state := map[string]*PersistedError{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// loadState reloads the clusters that were in error when the watcher
+// stopped. Clusters that do not exist anymore are forgotten, and removed from
+// the store. The other ones are reconciled by the first check : they are only
+// notified if they recovered in the meantime.
+func (cw *ClusterWatcher) loadState() {
+	state, err := cw.StateStore.Load()
+	if err != nil {
+		glog.Errorf("Unable to load the watcher state : %v", err)
+		return
+	}
+
+	cw.lock.Lock()
+	forgotten := 0
+	for name, persisted := range state {
+		cluster, ok := cw.Watcher.Services[name]
+		if !ok {
+			glog.Infof("Cluster %s was in error but does not exist anymore", name)
+			forgotten++
+			continue
+		}
+
+		var lastError error
+		if persisted.LastError != "" {
+			lastError = errors.New(persisted.LastError)
+		}
+		cw.inError[name] = &errorState{
+			Cluster:   cluster,
+			Since:     persisted.Since,
+			LastError: lastError,
+		}
+	}
+	glog.Infof("Reloaded %d clusters in error", len(cw.inError))
+	cw.lock.Unlock()
+
+	if forgotten > 0 {
+		cw.saveState()
+	}
+}
+
+func (cw *ClusterWatcher) saveState() {
+	if cw.StateStore == nil || (cw.Election != nil && !cw.Election.IsLeader()) {
+		return
+	}
+
+	cw.saveLock.Lock()
+	defer cw.saveLock.Unlock()
+
+	cw.lock.Lock()
+	state := make(map[string]*PersistedError, len(cw.inError))
+	for name, errState := range cw.inError {
+		persisted := &PersistedError{Since: errState.Since}
+		if errState.LastError != nil {
+			persisted.LastError = errState.LastError.Error()
+		}
+		state[name] = persisted
+	}
+	cw.lock.Unlock()
+
+	if err := cw.StateStore.Save(state); err != nil {
+		glog.Errorf("Unable to save the watcher state : %v", err)
+	}
+}
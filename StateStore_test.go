@@ -0,0 +1,149 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"github.com/coreos/go-etcd/etcd"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeEtcd is an in-memory etcd keeping only leaf values. Directories
+// exist as soon as a key is stored under them.
+type fakeEtcd struct {
+	values map[string]string
+}
+
+func (f *fakeEtcd) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	for k, v := range f.values {
+		if k == key {
+			return &etcd.Response{Node: &etcd.Node{Key: k, Value: v}}, nil
+		}
+		if strings.HasPrefix(k, key+"/") {
+			return &etcd.Response{Node: &etcd.Node{Key: key, Dir: true}}, nil
+		}
+	}
+	return nil, &etcd.EtcdError{ErrorCode: 100, Message: "Key not found", Cause: key}
+}
+
+func (f *fakeEtcd) Set(key string, value string, ttl uint64) (*etcd.Response, error) {
+	f.values[key] = value
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func testState() map[string]*PersistedError {
+	since := time.Date(2015, 3, 10, 12, 0, 0, 0, time.UTC)
+	return map[string]*PersistedError{
+		"nxio_000001": {Since: since, LastError: "instance 1 is stopped"},
+		"nxio_000002": {Since: since.Add(time.Hour)},
+	}
+}
+
+func TestFileStateStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := &FileStateStore{Path: filepath.Join(dir, "state.json")}
+
+	state, err := store.Load()
+	if err != nil || len(state) != 0 {
+		t.Fatalf("expected a missing file to be an empty state, got %v, %v", state, err)
+	}
+
+	if err := store.Save(testState()); err != nil {
+		t.Fatal(err)
+	}
+	state, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state, testState()) {
+		t.Errorf("expected %v, got %v", testState(), state)
+	}
+
+	// Save replaces the file without leaving temporary files
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected only the state file in %s, got %d files", dir, len(files))
+	}
+}
+
+func TestFileStateStoreCorruptFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	ioutil.WriteFile(path, []byte(`{"nxio_000001": {"since": `), 0600)
+
+	if _, err := (&FileStateStore{Path: path}).Load(); err == nil {
+		t.Error("expected an error for a corrupt state file")
+	}
+}
+
+func TestEtcdStateStoreRoundTrip(t *testing.T) {
+	client := &fakeEtcd{values: map[string]string{}}
+	store := &EtcdStateStore{Client: client, Key: "/arkenctl/state"}
+
+	state, err := store.Load()
+	if err != nil || len(state) != 0 {
+		t.Fatalf("expected a missing key to be an empty state, got %v, %v", state, err)
+	}
+
+	if err := store.Save(testState()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(client.values["/arkenctl/state"], `"lastError":"instance 1 is stopped"`) {
+		t.Errorf("unexpected value %s", client.values["/arkenctl/state"])
+	}
+	state, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state, testState()) {
+		t.Errorf("expected %v, got %v", testState(), state)
+	}
+
+	client.values["/arkenctl/state"] = "not json"
+	if _, err := store.Load(); err == nil {
+		t.Error("expected an error for a corrupt state")
+	}
+}
+
+func TestLoadStateReconciles(t *testing.T) {
+	client := &fakeEtcd{values: map[string]string{}}
+	store := &EtcdStateStore{Client: client, Key: "/arkenctl/state"}
+	store.Save(testState())
+
+	// nxio_000002 was removed while the watcher was stopped
+	cluster := &ServiceCluster{Name: "nxio_000001"}
+	cw := &ClusterWatcher{
+		Watcher:    &Watcher{Services: map[string]*ServiceCluster{"nxio_000001": cluster}},
+		StateStore: store,
+		inError:    make(map[string]*errorState),
+	}
+	cw.loadState()
+
+	if len(cw.inError) != 1 {
+		t.Fatalf("expected 1 cluster in error, got %d", len(cw.inError))
+	}
+	errState := cw.inError["nxio_000001"]
+	if errState == nil || errState.Cluster != cluster || !errState.Since.Equal(testState()["nxio_000001"].Since) {
+		t.Errorf("unexpected error state %+v", errState)
+	}
+	if errState.LastError == nil || errState.LastError.Error() != "instance 1 is stopped" {
+		t.Errorf("expected the last error to be reloaded, got %v", errState.LastError)
+	}
+
+	// The removed cluster is also forgotten by the store
+	state, _ := store.Load()
+	if _, ok := state["nxio_000002"]; ok || len(state) != 1 {
+		t.Errorf("expected the store to be saved after reconciliation, got %v", state)
+	}
+}
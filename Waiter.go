@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/arkenio/goarken"
+	"github.com/codegangsta/cli"
+	"github.com/coreos/go-etcd/etcd"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// targetStatuses are the statuses reached by the services at the end of
+// each action.
+var targetStatuses = map[string]string{
+	"start":     STARTED_STATUS,
+	"stop":      STOPPED_STATUS,
+	"passivate": PASSIVATED_STATUS,
+}
+
+// WaitClient is the part of the etcd client used by StatusWaiter.
+type WaitClient interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error)
+}
+
+// StatusWaiter waits for services to reach a status by watching their etcd
+// keys. Status changes are printed to Out as they happen.
+type StatusWaiter struct {
+	Client  WaitClient
+	Timeout time.Duration
+	// Settle is the time after which an error status is final even if the
+	// current status did not change
+	Settle time.Duration
+	Out    io.Writer
+}
+
+// DefaultWaitSettle is the settle period of the waiters of the commands.
+const DefaultWaitSettle = 30 * time.Second
+
+// Wait blocks until the computed status of the service is target, and
+// returns that status. It fails on timeout, or if the service is in error
+// once settled : right after the expected status is written, the status is
+// computed as error until the current status follows (e.g. expected started
+// while still stopped). An error is thus final only once the current status
+// changed, or after the Settle period.
+func (sw *StatusWaiter) Wait(service *Service, target string) (*Status, error) {
+	timeout := time.After(sw.Timeout)
+	settle := time.After(sw.Settle)
+	settled := sw.Settle <= 0
+	receiver := make(chan *etcd.Response)
+	stop := make(chan bool)
+	watching := false
+	defer func() {
+		close(stop)
+		if watching {
+			// Drains the response the watch may be sending when stopped
+			go func() {
+				for range receiver {
+				}
+			}()
+		}
+	}()
+
+	last, initialCurrent := "", ""
+	for first := true; ; first = false {
+		status, index, err := sw.readStatus(service)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the status of %s/%s : %v", service.Name, service.Index, err)
+		}
+		if first {
+			initialCurrent = status.Current
+		}
+
+		computed := status.Compute()
+		if computed != last {
+			fmt.Fprintf(sw.Out, "%s/%s : %s\n", service.Name, service.Index, computed)
+			last = computed
+		}
+		switch computed {
+		case target:
+			return status, nil
+		case ERROR_STATUS:
+			if !settled && status.Current == initialCurrent {
+				break
+			}
+			return status, fmt.Errorf("%s/%s is in error while waiting for %s", service.Name, service.Index, target)
+		}
+
+		if !watching {
+			watching = true
+			go sw.Client.Watch(service.NodeKey, index+1, true, receiver, stop)
+		}
+
+		select {
+		case _, ok := <-receiver:
+			if !ok {
+				watching = false
+				return status, fmt.Errorf("Watch on %s stopped while waiting for %s", service.NodeKey, target)
+			}
+		case <-settle:
+			settled = true
+		case <-timeout:
+			return status, fmt.Errorf("Timeout while waiting for %s/%s to be %s, status is %s", service.Name, service.Index, target, computed)
+		}
+	}
+}
+
+// readStatus reads the status keys of the service, and returns them with
+// the etcd index they were read at.
+func (sw *StatusWaiter) readStatus(service *Service) (*Status, uint64, error) {
+	resp, err := sw.Client.Get(service.NodeKey+"/status", false, true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	status := &Status{Service: service}
+	for _, node := range resp.Node.Nodes {
+		switch path.Base(node.Key) {
+		case "alive":
+			status.Alive = node.Value
+		case "current":
+			status.Current = node.Value
+		case "expected":
+			status.Expected = node.Value
+		}
+	}
+	return status, resp.EtcdIndex, nil
+}
+
+// waitFor wraps the action so that it only returns once the service reached
+// the target status of the action, when --wait is given.
+func waitFor(c *cli.Context, client WaitClient, action string, serviceAction ServiceAction) ServiceAction {
+	if !c.Bool("wait") || c.GlobalBool("dryRun") {
+		return serviceAction
+	}
+
+	return newStatusWaiter(c, client).After(serviceAction, targetStatuses[action])
+}
+
+func newStatusWaiter(c *cli.Context, client WaitClient) *StatusWaiter {
+	return &StatusWaiter{
+		Client:  client,
+		Timeout: time.Duration(c.Int("timeout")) * time.Second,
+		Settle:  DefaultWaitSettle,
+		Out:     os.Stderr,
+	}
+}
+
+// After wraps the action so that it returns once the service reached the
+// target status. The returned service has the status that was waited for.
+func (sw *StatusWaiter) After(serviceAction ServiceAction, target string) ServiceAction {
+	return func(service *Service) (*Service, error) {
+		updated, err := serviceAction(service)
+		if err != nil {
+			return updated, err
+		}
+		if updated == nil {
+			updated = service
+		}
+		status, err := sw.Wait(updated, target)
+		if status == nil {
+			return updated, err
+		}
+		waited := *updated
+		waited.Status = status
+		return &waited, err
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	. "github.com/arkenio/goarken"
+	"github.com/coreos/go-etcd/etcd"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWaitClient is an in-memory etcd, whose watches are woken up by set.
+type fakeWaitClient struct {
+	lock     sync.Mutex
+	values   map[string]string
+	index    uint64
+	watchers []chan struct{}
+}
+
+func newFakeWaitClient(values map[string]string) *fakeWaitClient {
+	return &fakeWaitClient{values: values}
+}
+
+func (f *fakeWaitClient) set(key, value string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.values[key] = value
+	f.index++
+	for _, w := range f.watchers {
+		select {
+		case w <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (f *fakeWaitClient) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	node := &etcd.Node{Key: key, Dir: true}
+	for k, v := range f.values {
+		if strings.HasPrefix(k, key+"/") {
+			node.Nodes = append(node.Nodes, &etcd.Node{Key: k, Value: v})
+		}
+	}
+	return &etcd.Response{Node: node, EtcdIndex: f.index}, nil
+}
+
+func (f *fakeWaitClient) Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error) {
+	defer close(receiver)
+	changed := make(chan struct{}, 1)
+	f.lock.Lock()
+	f.watchers = append(f.watchers, changed)
+	f.lock.Unlock()
+
+	for {
+		select {
+		case <-changed:
+			select {
+			case receiver <- &etcd.Response{}:
+			case <-stop:
+				return nil, nil
+			}
+		case <-stop:
+			return nil, nil
+		}
+	}
+}
+
+const waitKey = "/services/nxio_000001/1/status"
+
+func waitService() *Service {
+	return &Service{Name: "nxio_000001", Index: "1", NodeKey: "/services/nxio_000001/1"}
+}
+
+func newTestWaiter(client WaitClient, timeout, settle time.Duration) *StatusWaiter {
+	return &StatusWaiter{Client: client, Timeout: timeout, Settle: settle, Out: ioutil.Discard}
+}
+
+func TestWaitToleratesTransitionalError(t *testing.T) {
+	client := newFakeWaitClient(map[string]string{
+		waitKey + "/expected": STARTED_STATUS,
+		waitKey + "/current":  STOPPED_STATUS,
+	})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		client.set(waitKey+"/current", STARTING_STATUS)
+		time.Sleep(20 * time.Millisecond)
+		client.set(waitKey+"/alive", "1")
+		client.set(waitKey+"/current", STARTED_STATUS)
+	}()
+
+	status, err := newTestWaiter(client, 2*time.Second, time.Second).Wait(waitService(), STARTED_STATUS)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if status.Current != STARTED_STATUS {
+		t.Errorf("expected current started, got %s", status.Current)
+	}
+}
+
+func TestWaitFailsWhenErrorAfterCurrentChanged(t *testing.T) {
+	client := newFakeWaitClient(map[string]string{
+		waitKey + "/expected": STARTED_STATUS,
+		waitKey + "/current":  STOPPED_STATUS,
+	})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		client.set(waitKey+"/current", STARTING_STATUS)
+		time.Sleep(20 * time.Millisecond)
+		client.set(waitKey+"/current", STOPPING_STATUS)
+	}()
+
+	start := time.Now()
+	_, err := newTestWaiter(client, 2*time.Second, time.Second).Wait(waitService(), STARTED_STATUS)
+	if err == nil || !strings.Contains(err.Error(), "is in error") {
+		t.Fatalf("expected an error status, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("the error must not wait for the settle period")
+	}
+}
+
+func TestWaitFailsOnErrorOnceSettled(t *testing.T) {
+	client := newFakeWaitClient(map[string]string{
+		waitKey + "/expected": STARTED_STATUS,
+		waitKey + "/current":  STOPPED_STATUS,
+	})
+
+	_, err := newTestWaiter(client, 2*time.Second, 50*time.Millisecond).Wait(waitService(), STARTED_STATUS)
+	if err == nil || !strings.Contains(err.Error(), "is in error") {
+		t.Fatalf("expected an error status, got %v", err)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	client := newFakeWaitClient(map[string]string{
+		waitKey + "/expected": STARTED_STATUS,
+		waitKey + "/current":  STARTING_STATUS,
+	})
+
+	_, err := newTestWaiter(client, 50*time.Millisecond, time.Second).Wait(waitService(), STARTED_STATUS)
+	if err == nil || !strings.Contains(err.Error(), "Timeout") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
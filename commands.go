@@ -2,31 +2,79 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"github.com/arkenio/goarken"
 	"github.com/arkenio/goarken/drivers"
 	"github.com/codegangsta/cli"
 	"github.com/coreos/go-etcd/etcd"
+	"github.com/golang/glog"
+	"os"
+	"strings"
+	"time"
 )
 
 type Runnable func(stop chan interface{}) error
 
+// ExitError is returned by commands that must exit with a given code. Its
+// message, if any, has not been printed yet.
+type ExitError struct {
+	Code    int
+	Message string
+}
+
+func (e *ExitError) Error() string {
+	return e.Message
+}
+
+// exitOnError prints the error, if any, and exits with its code.
+func exitOnError(err error) {
+	if err == nil {
+		return
+	}
+
+	code := 1
+	if exitErr, ok := err.(*ExitError); ok {
+		code = exitErr.Code
+	}
+	if err.Error() != "" {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(code)
+}
+
 func GetGlobalFlags() []cli.Flag {
 	flags := []cli.Flag{
 
 		cli.StringFlag{
-			Name:  "etcdAddress",
-			Value: "http://127.0.0.1:4001/",
-			Usage: "etcd http endpoint",
+			Name:   "context",
+			EnvVar: "ARKENCTL_CONTEXT",
+			Value:  "",
+			Usage:  "Context of the configuration file to use, default to its current context",
 		},
 		cli.StringFlag{
-			Name:  "domainDir",
-			Value: "/domains",
-			Usage: "etcd prefix to get domains",
+			Name:   "config",
+			EnvVar: "ARKENCTL_CONFIG",
+			Value:  "",
+			Usage:  "Configuration file, default to ~/.arkenctl/config.yaml",
 		},
+
 		cli.StringFlag{
-			Name:  "serviceDir",
-			Value: "/services",
-			Usage: "etcd prefix to get services",
+			Name:   "etcdAddress",
+			EnvVar: "ARKENCTL_ETCD_ADDRESS",
+			Value:  "http://127.0.0.1:4001/",
+			Usage:  "etcd http endpoint",
+		},
+		cli.StringFlag{
+			Name:   "domainDir",
+			EnvVar: "ARKENCTL_DOMAIN_DIR",
+			Value:  "/domains",
+			Usage:  "etcd prefix to get domains",
+		},
+		cli.StringFlag{
+			Name:   "serviceDir",
+			EnvVar: "ARKENCTL_SERVICE_DIR",
+			Value:  "/services",
+			Usage:  "etcd prefix to get services",
 		},
 		cli.BoolFlag{
 			Name:  "logtostderr",
@@ -34,8 +82,49 @@ func GetGlobalFlags() []cli.Flag {
 		},
 		cli.StringFlag{
 			Name: "driver",
+			EnvVar: "ARKENCTL_DRIVER",
 			Value: "fleet",
-			Usage: "Service driver to use (fleet, rancher)",
+			Usage: "Service driver to use (fleet, rancher, etcd, docker, kubernetes or exec:<plugin path>)",
+		},
+
+		cli.BoolFlag{
+			Name:  "dryRun, dry-run",
+			Usage: "Print the driver calls instead of making them",
+		},
+		cli.BoolFlag{
+			Name:  "yes, y",
+			Usage: "Do not ask for confirmation before acting on services",
+		},
+
+		cli.IntFlag{
+			Name: "driverTimeout",
+			Value: 120,
+			Usage: "Number of seconds after which a driver call fails, 0 for no timeout",
+		},
+		cli.IntFlag{
+			Name: "driverRetries",
+			Value: 0,
+			Usage: "Number of retries of driver calls failing with a transient error",
+		},
+		cli.IntFlag{
+			Name: "driverRetryBackoff",
+			Value: 1,
+			Usage: "Number of seconds before the first retry, doubled at each retry",
+		},
+		cli.IntFlag{
+			Name: "driverRateLimit",
+			Value: 0,
+			Usage: "Maximum number of driver calls per minute, 0 for no limit",
+		},
+		cli.StringFlag{
+			Name: "auditFile",
+			Value: "",
+			Usage: "JSONL file to which a record of each driver call is appended",
+		},
+		cli.StringFlag{
+			Name: "auditPrefix",
+			Value: "",
+			Usage: "etcd directory in which a record of each driver call is stored, e.g. /arkenctl/audit",
 		},
 
 		cli.StringFlag{
@@ -58,11 +147,111 @@ func GetGlobalFlags() []cli.Flag {
 			Value: "",
 			Usage: "The secret key to use to connect to Rancher",
 		},
+
+		cli.StringFlag{
+			Name: "dockerHost",
+			EnvVar: "DOCKER_HOST",
+			Value: DefaultDockerHost,
+			Usage: "Docker daemon to use with the docker driver",
+		},
+
+		cli.StringFlag{
+			Name: "dockerLabel",
+			Value: DefaultDockerLabel,
+			Usage: "Container label holding the unit name of the service",
+		},
+
+		cli.StringFlag{
+			Name: "dockerPassivate",
+			Value: "pause",
+			Usage: "How the docker driver passivates containers : pause or stop",
+		},
+
+		cli.StringFlag{
+			Name: "kubeconfig",
+			EnvVar: "KUBECONFIG",
+			Value: "",
+			Usage: "kubeconfig file of the kubernetes driver, default to ~/.kube/config or the pod service account",
+		},
+
+		cli.StringFlag{
+			Name: "kubeContext",
+			Value: "",
+			Usage: "kubeconfig context to use, default to its current context",
+		},
+
+		cli.StringFlag{
+			Name: "kubeNamespace",
+			Value: "",
+			Usage: "Namespace of the deployments, default to the namespace of the context",
+		},
+
+		cli.StringFlag{
+			Name: "kubeDeployment",
+			Value: DefaultKubernetesDeployment,
+			Usage: "Template of the name of the deployment of a service",
+		},
+
+		cli.IntFlag{
+			Name: "kubeReplicas",
+			Value: 1,
+			Usage: "Number of replicas of a started deployment",
+		},
 	}
 
 	return flags
 }
 
+// bulkServiceFlags are the flags of the commands acting on several services.
+func bulkServiceFlags() []cli.Flag {
+	flags := append(selectionFlags(),
+		cli.IntFlag{
+			Name:  "parallel",
+			Value: 1,
+			Usage: "Number of services to act on concurrently",
+		},
+	)
+	return append(flags, waitFlags()...)
+}
+
+// selectionFlags are the flags selecting the services to act on.
+func selectionFlags() []cli.Flag {
+	return []cli.Flag{
+
+		cli.StringFlag{
+			Name:  "filter, selector",
+			Value: "",
+			Usage: "Only act on services matching this expression, e.g. 'status in (error,warning) && lastAccess < now-7d'",
+		},
+		cli.StringFlag{
+			Name:  "status",
+			Value: "",
+			Usage: "Only act on services in the given status",
+		},
+		cli.StringFlag{
+			Name:  "index",
+			Value: "",
+			Usage: "Only act on the instance with this index, also written name/index",
+		},
+	}
+}
+
+// waitFlags are the flags of the commands that may wait for the services to
+// reach their new status.
+func waitFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:  "wait",
+			Usage: "Wait for the services to reach their new status",
+		},
+		cli.IntFlag{
+			Name:  "timeout",
+			Value: 300,
+			Usage: "Time to wait for each service, in seconds",
+		},
+	}
+}
+
 func GetCommands(stop chan interface{}) []cli.Command {
 
 	commands := []cli.Command{
@@ -77,6 +266,10 @@ func GetCommands(stop chan interface{}) []cli.Command {
 					Usage:  "The datadog API key, if set, metrics are sent to datadog",
 					EnvVar: "DD_API_KEY",
 				},
+				cli.BoolFlag{
+					Name:   "single",
+					Usage:  "Check the cluster once and exit",
+				},
 				cli.IntFlag{
 					Name:   "checkCount",
 					Value:  1,
@@ -87,9 +280,172 @@ func GetCommands(stop chan interface{}) []cli.Command {
 					Value:  5,
 					Usage:  "Number of seconds before rechecking a service status",
 				},
+				cli.IntFlag{
+					Name:   "checkWorkers",
+					Value:  4,
+					Usage:  "Number of service checks that may run concurrently",
+				},
+				cli.IntFlag{
+					Name:   "flapThreshold",
+					Value:  0,
+					Usage:  "Number of state changes during flapWindow after which a service is flapping, 0 to disable",
+				},
+				cli.IntFlag{
+					Name:   "flapWindow",
+					Value:  600,
+					Usage:  "Number of seconds during which state changes are counted to detect flapping",
+				},
+				cli.BoolFlag{
+					Name:   "probe",
+					Usage:  "Check that started instances accept connections on their location",
+				},
+				cli.IntFlag{
+					Name:   "probeTimeout",
+					Value:  5,
+					Usage:  "Number of seconds before a probe fails",
+				},
+				cli.StringFlag{
+					Name:   "probeHttpPath",
+					Value:  "",
+					Usage:  "If set, probes also GET this path on the instance location",
+				},
+				cli.IntFlag{
+					Name:   "probeHttpStatus",
+					Value:  200,
+					Usage:  "HTTP status expected when probing probeHttpPath",
+				},
+				cli.StringSliceFlag{
+					Name:   "remediate",
+					Value:  &cli.StringSlice{},
+					Usage:  "Remediation rule to apply to services in error (e.g. start:expected=started,current=stopped,checks=3), may be repeated",
+				},
+				cli.IntFlag{
+					Name:   "remediationInterval",
+					Value:  30,
+					Usage:  "Number of seconds between two evaluations of the remediation rules",
+				},
+				cli.IntFlag{
+					Name:   "remediationCooldown",
+					Value:  30,
+					Usage:  "Number of minutes a service must stay healthy before its remediation attempts are forgotten",
+				},
+				cli.BoolFlag{
+					Name:   "leaderElection",
+					Usage:  "Elect a leader among several watchers, only the leader notifies and remediates",
+				},
+				cli.StringFlag{
+					Name:   "leaderPrefix",
+					Value:  "/arkenctl/watch",
+					Usage:  "etcd prefix used for the leader election",
+				},
+				cli.StringFlag{
+					Name:   "leaderId",
+					Value:  "",
+					Usage:  "Identity of this watcher in the leader election (default to hostname:pid)",
+				},
+				cli.IntFlag{
+					Name:   "leaderTTL",
+					Value:  30,
+					Usage:  "Number of seconds after which a leader that did not refresh its lease is replaced",
+				},
+				cli.StringFlag{
+					Name:   "stateFile",
+					Value:  "",
+					Usage:  "File in which the services in error are persisted across restarts",
+				},
+				cli.StringFlag{
+					Name:   "stateKey",
+					Value:  "",
+					Usage:  "etcd key in which the services in error are persisted across restarts",
+				},
+				cli.StringFlag{
+					Name:   "metricsListen",
+					Value:  "",
+					Usage:  "Address (e.g. :9101) on which to serve prometheus metrics at /metrics",
+				},
+				cli.StringSliceFlag{
+					Name:   "notify",
+					Value:  &cli.StringSlice{},
+					Usage:  "Notifier to send alerts to (log, datadog, webhook:<url>, slack:<url>, exec:<command>), may be repeated",
+				},
+			},
+			Action: func(c *cli.Context) {
+				exitOnError(NewClusterWatcher(c)(stop))
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:  "status",
+					Usage: "Prints the current leader of the watchers",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "leaderPrefix",
+							Value: "/arkenctl/watch",
+							Usage: "etcd prefix used for the leader election",
+						},
+					},
+					Action: func(c *cli.Context) {
+						exitOnError(NewWatchStatusCommand(c)(stop))
+					},
+				},
+			},
+		},
+		{
+			Name:  "check",
+			Usage: "Check the cluster once and report as a Nagios plugin",
+			Flags: []cli.Flag{
+
+				cli.IntFlag{
+					Name:  "warning",
+					Value: 1,
+					Usage: "Number of services in error or in warning from which the status is WARNING, 0 to disable",
+				},
+				cli.IntFlag{
+					Name:  "critical",
+					Value: 10,
+					Usage: "Number of services in error from which the status is CRITICAL, 0 to disable",
+				},
+			},
+			Action: func(c *cli.Context) {
+				exitOnError(NewCheckCommand(c)(stop))
+			},
+		},
+		{
+			Name:  "reaper",
+			Usage: "Periodically passivate the services that are idle",
+			Flags: []cli.Flag{
+
+				cli.IntFlag{
+					Name:  "idleMinutes",
+					Value: 1440,
+					Usage: "Number of minutes without access after which a service is passivated",
+				},
+				cli.StringSliceFlag{
+					Name:  "include",
+					Value: &cli.StringSlice{},
+					Usage: "Only passivate services whose name matches this pattern (e.g. nxio_*), may be repeated",
+				},
+				cli.StringSliceFlag{
+					Name:  "exclude",
+					Value: &cli.StringSlice{},
+					Usage: "Never passivate services whose name matches this pattern, may be repeated",
+				},
+				cli.IntFlag{
+					Name:  "maxPassivations",
+					Value: 10,
+					Usage: "Maximum number of services passivated per cycle, 0 for no limit",
+				},
+				cli.IntFlag{
+					Name:  "interval",
+					Value: 300,
+					Usage: "Number of seconds between two cycles",
+				},
+				cli.BoolFlag{
+					Name:  "once",
+					Usage: "Run a single cycle and exit",
+				},
 			},
 			Action: func(c *cli.Context) {
-				NewClusterWatcher(c)(stop)
+				exitOnError(NewReaperCommand(c)(stop))
 			},
 		},
 		{
@@ -100,7 +456,7 @@ func GetCommands(stop chan interface{}) []cli.Command {
 					Name:  "list",
 					Usage: "List all services in the cluster",
 					Action: func(c *cli.Context) {
-						NewServiceListCommand(c)(stop)
+						exitOnError(NewServiceListCommand(c)(stop))
 					},
 					Flags: []cli.Flag{
 
@@ -109,48 +465,89 @@ func GetCommands(stop chan interface{}) []cli.Command {
 							Value: "",
 							Usage: "Show only services in the given status",
 						},
+						cli.StringFlag{
+							Name:  "filter, selector",
+							Value: "",
+							Usage: "Only show services matching this expression, e.g. 'status in (error,warning) && lastAccess < now-7d'",
+						},
+						cli.StringFlag{
+							Name:  "index",
+							Value: "",
+							Usage: "Only show the instance with this index, also written name/index",
+						},
 						cli.StringFlag{
 							Name:  "template",
 							Value: "",
 							Usage: "template to use to render the output",
 						},
+						cli.StringFlag{
+							Name:  "output",
+							Value: "",
+							Usage: "Output format : json or yaml, default to text",
+						},
 					},
 				},
 				{
 					Name:  "cat",
 					Usage: "Get the infos for a service",
 					Action: func(c *cli.Context) {
-						NewServiceInfoCommand(c)(stop)
+						exitOnError(NewServiceInfoCommand(c)(stop))
 					},
 					Flags: []cli.Flag{
 
+						cli.StringFlag{
+							Name:  "filter, selector",
+							Value: "",
+							Usage: "Only show services matching this expression, e.g. 'status in (error,warning) && lastAccess < now-7d'",
+						},
+						cli.StringFlag{
+							Name:  "index",
+							Value: "",
+							Usage: "Only show the instance with this index, also written name/index",
+						},
 						cli.StringFlag{
 							Name:  "template",
 							Value: "",
 							Usage: "template to use to render the output",
 						},
+						cli.StringFlag{
+							Name:  "output",
+							Value: "",
+							Usage: "Output format : json or yaml, default to text",
+						},
 					},
 				},
 				{
 					Name:  "start",
-					Usage: "Starts the given service",
+					Usage: "Starts the given services",
 					Action: func(c *cli.Context) {
-						NewServiceStartCommand(c)(stop)
+						exitOnError(NewServiceStartCommand(c)(stop))
 					},
+					Flags: bulkServiceFlags(),
 				},
 				{
 					Name:  "stop",
-					Usage: "Watch the cluster for inconsistency and log errors",
+					Usage: "Stops the given services",
 					Action: func(c *cli.Context) {
-						NewServiceStopCommand(c)(stop)
+						exitOnError(NewServiceStopCommand(c)(stop))
 					},
+					Flags: bulkServiceFlags(),
 				},
 				{
 					Name:  "passivate",
-					Usage: "Watch the cluster for inconsistency and log errors",
+					Usage: "Passivates the given services",
+					Action: func(c *cli.Context) {
+						exitOnError(NewServicePassivateCommand(c)(stop))
+					},
+					Flags: bulkServiceFlags(),
+				},
+				{
+					Name:  "restart",
+					Usage: "Restarts the instances of the given services one at a time",
 					Action: func(c *cli.Context) {
-						NewServicePassivateCommand(c)(stop)
+						exitOnError(NewServiceRestartCommand(c)(stop))
 					},
+					Flags: append(selectionFlags(), restartFlags()...),
 				},
 			},
 		},
@@ -163,35 +560,102 @@ func GetCommands(stop chan interface{}) []cli.Command {
 					Name:  "list",
 					Usage: "list the domains",
 					Action: func(c *cli.Context) {
-						NewDomainListCommand(c)(stop)
+						exitOnError(NewDomainListCommand(c)(stop))
+					},
+					Flags: []cli.Flag{
+
+						cli.StringFlag{
+							Name:  "output",
+							Value: "",
+							Usage: "Output format : json or yaml, default to text",
+						},
 					},
 				},
 				{
 					Name:  "cat",
 					Usage: "Gets the info of a domain",
 					Action: func(c *cli.Context) {
-						NewDomainInfoCommand(c)(stop)
+						exitOnError(NewDomainInfoCommand(c)(stop))
+					},
+					Flags: []cli.Flag{
+
+						cli.StringFlag{
+							Name:  "output",
+							Value: "",
+							Usage: "Output format : json or yaml, default to text",
+						},
 					},
 				},
 				{
 					Name:  "start",
 					Usage: "Starts the service associated to the domain",
 					Action: func(c *cli.Context) {
-						NewDomainStartCommand(c)(stop)
+						exitOnError(NewDomainStartCommand(c)(stop))
 					},
+					Flags: waitFlags(),
 				},
 				{
 					Name:  "stop",
 					Usage: "Stop the service associated to the domain",
 					Action: func(c *cli.Context) {
-						NewDomainStopCommand(c)(stop)
+						exitOnError(NewDomainStopCommand(c)(stop))
 					},
+					Flags: waitFlags(),
 				},
 				{
 					Name:  "passivate",
 					Usage: "Passivate the service associated to the domain",
 					Action: func(c *cli.Context) {
-						NewDomainPassivateCommand(c)(stop)
+						exitOnError(NewDomainPassivateCommand(c)(stop))
+					},
+					Flags: waitFlags(),
+				},
+				{
+					Name:  "restart",
+					Usage: "Restarts the instances of the service associated to the domain one at a time",
+					Action: func(c *cli.Context) {
+						exitOnError(NewDomainRestartCommand(c)(stop))
+					},
+					Flags: restartFlags(),
+				},
+			},
+		},
+		{
+			Name:  "context",
+			Usage: "Manage the contexts of the configuration file",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "Lists the contexts",
+					Action: func(c *cli.Context) {
+						exitOnError(NewContextListCommand(c)(stop))
+					},
+				},
+				{
+					Name:  "use",
+					Usage: "Makes the given context the current one",
+					Action: func(c *cli.Context) {
+						exitOnError(NewContextUseCommand(c)(stop))
+					},
+				},
+				{
+					Name:  "show",
+					Usage: "Shows the settings of the given context, default to the current one",
+					Action: func(c *cli.Context) {
+						exitOnError(NewContextShowCommand(c)(stop))
+					},
+				},
+			},
+		},
+		{
+			Name:  "driver",
+			Usage: "Show informations about the service driver",
+			Subcommands: []cli.Command{
+				{
+					Name:  "info",
+					Usage: "Prints the driver settings and checks that it can reach its backend",
+					Action: func(c *cli.Context) {
+						exitOnError(NewDriverInfoCommand(c)(stop))
 					},
 				},
 			},
@@ -202,18 +666,46 @@ func GetCommands(stop chan interface{}) []cli.Command {
 }
 
 func CreateEtcdClientFromCli(c *cli.Context) *etcd.Client {
-	return etcd.NewClient([]string{c.GlobalString("etcdAddress")})
+	return etcd.NewClient(strings.Split(c.GlobalString("etcdAddress"), ","))
 }
 
 func CreateServiceDriverFromCli(c *cli.Context, etcdClient *etcd.Client ) drivers.ServiceDriver {
-	switch c.GlobalString("driver") {
-	case "rancher":
-		return drivers.NewRancherServiceDriver(etcdClient,
-			c.GlobalString("rancherHost"),c.GlobalString("rancherAccessKey"),c.GlobalString("rancherSecretKey"))
+	config := NewDriverConfigFromCli(c)
+	driver, err := config.NewDriver(etcdClient)
+	exitOnError(err)
+
+	if c.GlobalBool("dryRun") {
+		return &DryRunDriver{Name: config.Name, Out: os.Stdout}
+	}
+	return ChainDriver(driver, CreateDriverMiddlewaresFromCli(c, etcdClient)...)
+}
 
-	default:
-		return drivers.NewFleetServiceDriver(etcdClient)
+// CreateDriverMiddlewaresFromCli returns, from the outermost to the innermost,
+// the audit, rate limit, retry and timeout middlewares that are enabled.
+func CreateDriverMiddlewaresFromCli(c *cli.Context, etcdClient *etcd.Client) []DriverMiddleware {
+	middlewares := []DriverMiddleware{}
+
+	logs := []AuditLog{}
+	if path := c.GlobalString("auditFile"); path != "" {
+		logs = append(logs, &FileAuditLog{Path: path})
+	}
+	if prefix := c.GlobalString("auditPrefix"); prefix != "" {
+		logs = append(logs, &EtcdAuditLog{Client: etcdClient, Prefix: prefix})
+	}
+	if len(logs) > 0 {
+		middlewares = append(middlewares, WithAudit(logs...))
+	}
+
+	if perMinute := c.GlobalInt("driverRateLimit"); perMinute > 0 {
+		middlewares = append(middlewares, WithRateLimit(perMinute))
 	}
+	if retries := c.GlobalInt("driverRetries"); retries > 0 {
+		middlewares = append(middlewares, WithRetry(retries, time.Duration(c.GlobalInt("driverRetryBackoff"))*time.Second))
+	}
+	if timeout := c.GlobalInt("driverTimeout"); timeout > 0 {
+		middlewares = append(middlewares, WithTimeout(time.Duration(timeout)*time.Second))
+	}
+	return middlewares
 }
 
 func CreateWatcherFromCli(c *cli.Context, client *etcd.Client) *goarken.Watcher {
@@ -229,6 +721,11 @@ func CreateWatcherFromCli(c *cli.Context, client *etcd.Client) *goarken.Watcher
 }
 
 func NewClusterWatcher(c *cli.Context) Runnable {
+	notifier, err := NewMultiNotifier(c.StringSlice("notify"), c.String("datadogApiKey"))
+	if err != nil {
+		glog.Fatalf("Unable to configure notifications : %v", err)
+	}
+
 	client := CreateEtcdClientFromCli(c)
 	w := CreateWatcherFromCli(c, client)
 
@@ -237,12 +734,94 @@ func NewClusterWatcher(c *cli.Context) Runnable {
 		Client:        client,
 		SingleRun:     c.Bool("single"),
 		DataDogAPIKey: c.String("datadogApiKey"),
+		MetricsListen: c.String("metricsListen"),
 		CheckCount:    c.Int("checkCount"),
 		GracePeriod:   c.Int("checkGracePeriod"),
+		Workers:       c.Int("checkWorkers"),
+		FlapThreshold: c.Int("flapThreshold"),
+		FlapWindow:    c.Int("flapWindow"),
+		Notifier:      notifier,
+	}
+
+	for _, spec := range c.StringSlice("remediate") {
+		rule, err := ParseRemediationRule(spec)
+		if err != nil {
+			glog.Fatalf("Unable to configure remediations : %v", err)
+		}
+		cw.Remediations = append(cw.Remediations, rule)
+	}
+
+	if len(cw.Remediations) > 0 {
+		goarken.SetDomainPrefix(c.GlobalString("domainDir"))
+		goarken.SetServicePrefix(c.GlobalString("serviceDir"))
+		cw.Driver = CreateServiceDriverFromCli(c, client)
+		cw.RemediationInterval = c.Int("remediationInterval")
+		cw.RemediationCooldown = time.Duration(c.Int("remediationCooldown")) * time.Minute
+	}
+
+	if c.String("stateFile") != "" {
+		cw.StateStore = &FileStateStore{Path: c.String("stateFile")}
+	} else if c.String("stateKey") != "" {
+		cw.StateStore = &EtcdStateStore{Client: client, Key: c.String("stateKey")}
+	}
+
+	if c.Bool("leaderElection") {
+		cw.Election = NewLeaderElection(client, c.String("leaderPrefix"), c.String("leaderId"), uint64(c.Int("leaderTTL")))
+	}
+
+	if c.Bool("probe") {
+		cw.Prober = NewProber(time.Duration(c.Int("probeTimeout"))*time.Second,
+			c.String("probeHttpPath"), c.Int("probeHttpStatus"))
 	}
 	return cw.Watch
 }
 
+func NewWatchStatusCommand(c *cli.Context) Runnable {
+	election := NewLeaderElection(CreateEtcdClientFromCli(c), c.String("leaderPrefix"), "", 0)
+	return func(stop chan interface{}) error {
+		return election.PrintStatus(os.Stdout)
+	}
+}
+
+func NewCheckCommand(c *cli.Context) Runnable {
+	cc := &CheckCommand{
+		Client:   CreateEtcdClientFromCli(c),
+		Cli:      c,
+		Warning:  c.Int("warning"),
+		Critical: c.Int("critical"),
+		Out:      os.Stdout,
+	}
+	return cc.Run
+}
+
+func NewReaperCommand(c *cli.Context) Runnable {
+	if interval := c.Int("interval"); interval <= 0 && !c.Bool("once") {
+		return func(stop chan interface{}) error {
+			return fmt.Errorf("Invalid --interval %d, it must be a positive number of seconds", interval)
+		}
+	}
+
+	goarken.SetDomainPrefix(c.GlobalString("domainDir"))
+	goarken.SetServicePrefix(c.GlobalString("serviceDir"))
+
+	client := CreateEtcdClientFromCli(c)
+	w := CreateWatcherFromCli(c, client)
+
+	r := &Reaper{
+		Watcher:         w,
+		Driver:          CreateServiceDriverFromCli(c, client),
+		IdleTime:        time.Duration(c.Int("idleMinutes")) * time.Minute,
+		Include:         c.StringSlice("include"),
+		Exclude:         c.StringSlice("exclude"),
+		MaxPassivations: c.Int("maxPassivations"),
+		DryRun:          c.GlobalBool("dryRun"),
+		Interval:        c.Int("interval"),
+		SingleRun:       c.Bool("once"),
+		Out:             os.Stdout,
+	}
+	return r.Run
+}
+
 type NotImplementedCommand struct{}
 
 func (ni *NotImplementedCommand) Run(stop chan interface{}) error {
@@ -293,6 +872,10 @@ func NewServicePassivateCommand(c *cli.Context) Runnable {
 	return CreateServiceCommand(c).Passivate
 }
 
+func NewServiceRestartCommand(c *cli.Context) Runnable {
+	return CreateServiceCommand(c).Restart
+}
+
 func NewDomainListCommand(c *cli.Context) Runnable {
 	client := CreateEtcdClientFromCli(c)
 	w := CreateWatcherFromCli(c, client)
@@ -310,9 +893,12 @@ func NewDomainCommand(c *cli.Context) *DomainCommand {
 	goarken.SetDomainPrefix(c.GlobalString("domainDir"))
 	goarken.SetServicePrefix(c.GlobalString("serviceDir"))
 
+	etcdClient := CreateEtcdClientFromCli(c)
+
 	dc := &DomainCommand{
-		Client: CreateEtcdClientFromCli(c),
-		Cli:    c,
+		Client:        etcdClient,
+		ServiceDriver: CreateServiceDriverFromCli(c, etcdClient),
+		Cli:           c,
 	}
 
 	return dc
@@ -334,3 +920,43 @@ func NewDomainStopCommand(c *cli.Context) Runnable {
 func NewDomainPassivateCommand(c *cli.Context) Runnable {
 	return NewDomainCommand(c).Passivate
 }
+
+func NewDomainRestartCommand(c *cli.Context) Runnable {
+	return NewDomainCommand(c).Restart
+}
+
+func NewDriverInfoCommand(c *cli.Context) Runnable {
+	dc := &DriverInfoCommand{
+		Config: NewDriverConfigFromCli(c),
+		Client: CreateEtcdClientFromCli(c),
+		Cli:    c,
+		Out:    os.Stdout,
+	}
+
+	return dc.Run
+}
+
+func NewContextCommand(c *cli.Context) *ContextCommand {
+	path := c.GlobalString("config")
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+
+	return &ContextCommand{
+		Path: path,
+		Cli:  c,
+		Out:  os.Stdout,
+	}
+}
+
+func NewContextListCommand(c *cli.Context) Runnable {
+	return NewContextCommand(c).List
+}
+
+func NewContextUseCommand(c *cli.Context) Runnable {
+	return NewContextCommand(c).Use
+}
+
+func NewContextShowCommand(c *cli.Context) Runnable {
+	return NewContextCommand(c).Show
+}
@@ -1,44 +1,232 @@
 package main
 
 import (
-	"errors"
 	"flag"
-	"github.com/coreos/go-etcd/etcd"
-	"github.com/golang/glog"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
-type Config struct {
-	port             int
-	domainPrefix     string
-	servicePrefix    string
-	etcdAddress      string
-	client           *etcd.Client
-	cpuProfile       string
+// ConfigFile is the arkenctl configuration file, ~/.arkenctl/config.yaml by
+// default. Each context holds values of global flags, such as :
+//
+//     currentContext: prod
+//     contexts:
+//       prod:
+//         etcdAddress: http://etcd1.prod:4001/,http://etcd2.prod:4001/
+//         driver: rancher
+//         rancherEndpoint: http://rancher.prod:8080/v1
+type ConfigFile struct {
+	CurrentContext string                            `yaml:"currentContext,omitempty"`
+	Contexts       map[string]map[string]interface{} `yaml:"contexts"`
 }
 
-func (c *Config) getEtcdClient() (*etcd.Client, error) {
-	if c.client == nil {
-		c.client = etcd.NewClient([]string{c.etcdAddress})
-		if !c.client.SyncCluster() {
-			return nil, errors.New("Unable to sync with etcd cluster, check your configuration or etcd status")
+// DefaultConfigPath returns ~/.arkenctl/config.yaml.
+func DefaultConfigPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".arkenctl", "config.yaml")
+}
+
+// LoadConfigFile reads the configuration file. A missing file is an empty
+// configuration.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	config := &ConfigFile{Contexts: map[string]map[string]interface{}{}}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("Invalid configuration file %s : %v", path, err)
+	}
+	if config.Contexts == nil {
+		config.Contexts = map[string]map[string]interface{}{}
+	}
+	return config, nil
+}
+
+func (cf *ConfigFile) Save(path string) error {
+	data, err := yaml.Marshal(cf)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// ContextNames returns the names of the contexts, sorted.
+func (cf *ConfigFile) ContextNames() []string {
+	names := make([]string, 0, len(cf.Contexts))
+	for name := range cf.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Settings returns the flag values of a context, as strings. Lists, such as
+// several etcd endpoints, are joined with commas.
+func (cf *ConfigFile) Settings(context string) (map[string]string, error) {
+	values, ok := cf.Contexts[context]
+	if !ok {
+		return nil, fmt.Errorf("Unknown context %q", context)
+	}
+
+	settings := map[string]string{}
+	for name, value := range values {
+		if list, ok := value.([]interface{}); ok {
+			items := make([]string, 0, len(list))
+			for _, item := range list {
+				items = append(items, fmt.Sprint(item))
+			}
+			settings[name] = strings.Join(items, ",")
+		} else {
+			settings[name] = fmt.Sprint(value)
 		}
 	}
-	return c.client, nil
+	return settings, nil
 }
 
-func parseConfig() *Config {
-	config := &Config{}
-	flag.StringVar(&config.domainPrefix, "domainDir", "/domains", "etcd prefix to get domains")
-	flag.StringVar(&config.servicePrefix, "serviceDir", "/services", "etcd prefix to get services")
-	flag.StringVar(&config.etcdAddress, "etcdAddress", "http://127.0.0.1:4001/", "etcd client host")
-	flag.StringVar(&config.cpuProfile, "cpuProfile", "/tmp/arken-wd.prof", "File to dump cpuProfile")
-	flag.Parse()
+// globalFlag describes a global flag to apply context settings.
+type globalFlag struct {
+	names  []string
+	envVar string
+	isBool bool
+}
+
+func newGlobalFlag(f cli.Flag) *globalFlag {
+	var name, envVar string
+	isBool := false
+	switch f := f.(type) {
+	case cli.StringFlag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.IntFlag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.BoolFlag:
+		name, envVar, isBool = f.Name, f.EnvVar, true
+	case cli.StringSliceFlag:
+		name, envVar = f.Name, f.EnvVar
+	default:
+		return nil
+	}
+
+	gf := &globalFlag{envVar: envVar, isBool: isBool}
+	for _, n := range strings.Split(name, ",") {
+		gf.names = append(gf.names, strings.TrimSpace(n))
+	}
+	return gf
+}
+
+// ApplyContext returns the arguments with the settings of the context added
+// as global flags. The context is the one given with --context, or the
+// current context of the configuration file. Settings are only added for
+// flags that are neither given as arguments nor set by their environment
+// variable, so that flags take precedence over the environment, which takes
+// precedence over the context.
+func ApplyContext(args []string, flags []cli.Flag) ([]string, error) {
+	byName := map[string]*globalFlag{}
+	for _, f := range flags {
+		if gf := newGlobalFlag(f); gf != nil {
+			for _, name := range gf.names {
+				byName[name] = gf
+			}
+		}
+	}
+
+	// Only the global flags are parsed : parsing stops at the command
+	set := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
+	for name, gf := range byName {
+		if gf.isBool {
+			set.Bool(name, false, "")
+		} else {
+			set.String(name, "", "")
+		}
+	}
+	if err := set.Parse(args[1:]); err != nil {
+		// Let the cli report unknown flags, or handle --help and --version
+		return args, nil
+	}
+
+	given := map[*globalFlag]string{}
+	set.Visit(func(f *flag.Flag) {
+		given[byName[f.Name]] = f.Value.String()
+	})
+	command := set.Arg(0)
+
+	// The context commands must work even if the context is broken
+	if command == "context" {
+		return args, nil
+	}
+
+	configPath := valueOf(given, byName["config"])
+	if configPath == "" {
+		configPath = DefaultConfigPath()
+	}
+	config, err := LoadConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
 
-	glog.Infof("Dumping Configuration")
-	glog.Infof("  domainPrefix : %s", config.domainPrefix)
-	glog.Infof("  servicesPrefix : %s", config.servicePrefix)
-	glog.Infof("  etcdAddress : %s", config.etcdAddress)
-	glog.Infof("  cpuProfile: %s", config.cpuProfile)
+	context := valueOf(given, byName["context"])
+	if context == "" {
+		context = config.CurrentContext
+	}
+	if context == "" {
+		return args, nil
+	}
+
+	settings, err := config.Settings(context)
+	if err != nil {
+		return nil, fmt.Errorf("%v in %s", err, configPath)
+	}
 
-	return config
+	added := []string{}
+	for _, name := range sortedSettings(settings) {
+		gf, ok := byName[name]
+		if !ok || name == "context" || name == "config" {
+			return nil, fmt.Errorf("Unknown setting %q in context %s of %s", name, context, configPath)
+		}
+		if _, ok := given[gf]; ok {
+			continue
+		}
+		if gf.envVar != "" && os.Getenv(gf.envVar) != "" {
+			continue
+		}
+		added = append(added, "--"+name+"="+settings[name])
+	}
+
+	result := append([]string{args[0]}, added...)
+	return append(result, args[1:]...), nil
+}
+
+func valueOf(given map[*globalFlag]string, gf *globalFlag) string {
+	if gf == nil {
+		return ""
+	}
+	if value, ok := given[gf]; ok {
+		return value
+	}
+	if gf.envVar != "" {
+		return os.Getenv(gf.envVar)
+	}
+	return ""
+}
+
+func sortedSettings(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `currentContext: prod
+contexts:
+  prod:
+    etcdAddress: [http://etcd1.prod:4001/, http://etcd2.prod:4001/]
+    serviceDir: /prod/services
+    domainDir: /prod/domains
+    driver: etcd
+    dryRun: true
+    rancherSecretKey: s3cr3t-k3y
+  staging:
+    etcdAddress: http://etcd.staging:4001/
+`
+
+// writeTestConfig writes testConfig in a temporary directory, and returns
+// its path and a function removing it.
+func writeTestConfig(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "arkenctl-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+// globalsAfterContext applies the context to the arguments and returns the
+// global flag values seen by a command.
+func globalsAfterContext(t *testing.T, args ...string) map[string]string {
+	args, err := ApplyContext(append([]string{progname}, args...), GetGlobalFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values map[string]string
+	app := cli.NewApp()
+	app.Flags = GetGlobalFlags()
+	app.Commands = []cli.Command{{
+		Name: "probe",
+		Action: func(c *cli.Context) {
+			values = map[string]string{"dryRun": fmt.Sprint(c.GlobalBool("dryRun"))}
+			for _, name := range []string{"etcdAddress", "serviceDir", "domainDir", "driver"} {
+				values[name] = c.GlobalString(name)
+			}
+		},
+	}}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+	if values == nil {
+		t.Fatalf("the command was not run with %v", args)
+	}
+	return values
+}
+
+var cleanEnv = map[string]string{
+	"ARKENCTL_CONTEXT":      "",
+	"ARKENCTL_CONFIG":       "",
+	"ARKENCTL_ETCD_ADDRESS": "",
+	"ARKENCTL_SERVICE_DIR":  "",
+	"ARKENCTL_DOMAIN_DIR":   "",
+	"ARKENCTL_DRIVER":       "",
+}
+
+func TestApplyContextPrecedence(t *testing.T) {
+	path, cleanup := writeTestConfig(t)
+	defer cleanup()
+	defer setenv(cleanEnv)()
+	defer setenv(map[string]string{
+		"ARKENCTL_SERVICE_DIR": "/env/services",
+		"ARKENCTL_DRIVER":      "rancher",
+	})()
+
+	values := globalsAfterContext(t, "--config", path, "--driver", "exec:/usr/local/bin/driver", "probe")
+
+	expected := map[string]string{
+		"etcdAddress": "http://etcd1.prod:4001/,http://etcd2.prod:4001/", // context
+		"serviceDir":  "/env/services",                                   // env over context
+		"domainDir":   "/prod/domains",                                   // context
+		"driver":      "exec:/usr/local/bin/driver",                      // flag over env and context
+		"dryRun":      "true",                                            // context
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestApplyContextFlagForms(t *testing.T) {
+	path, cleanup := writeTestConfig(t)
+	defer cleanup()
+	defer setenv(cleanEnv)()
+
+	forms := [][]string{
+		{"--config", path, "--context", "staging", "--serviceDir", "/flag/services", "probe"},
+		{"--config=" + path, "--context=staging", "--serviceDir=/flag/services", "probe"},
+		{"-config", path, "-context=staging", "-serviceDir", "/flag/services", "probe"},
+	}
+	for _, args := range forms {
+		values := globalsAfterContext(t, args...)
+		if values["etcdAddress"] != "http://etcd.staging:4001/" {
+			t.Errorf("%v : expected the staging context, got %s", args, values["etcdAddress"])
+		}
+		if values["serviceDir"] != "/flag/services" {
+			t.Errorf("%v : expected the flag to be kept, got %s", args, values["serviceDir"])
+		}
+	}
+}
+
+func TestApplyContextBoolFlags(t *testing.T) {
+	path, cleanup := writeTestConfig(t)
+	defer cleanup()
+	defer setenv(cleanEnv)()
+
+	// A boolean flag does not take the command as its value
+	values := globalsAfterContext(t, "--config", path, "--dry-run", "probe")
+	if values["dryRun"] != "true" || values["serviceDir"] != "/prod/services" {
+		t.Errorf("expected the context to apply after a boolean flag, got %v", values)
+	}
+
+	// The alias of a flag set by the context takes precedence over it
+	values = globalsAfterContext(t, "--config", path, "--dry-run=false", "probe")
+	if values["dryRun"] != "false" {
+		t.Errorf("expected --dry-run=false to take precedence over the context, got %v", values["dryRun"])
+	}
+}
+
+func TestApplyContextUnknownContext(t *testing.T) {
+	path, cleanup := writeTestConfig(t)
+	defer cleanup()
+	defer setenv(cleanEnv)()
+
+	_, err := ApplyContext([]string{progname, "--config", path, "--context", "nope", "service", "list"}, GetGlobalFlags())
+	if err == nil || !strings.Contains(err.Error(), `Unknown context "nope"`) {
+		t.Errorf("expected an unknown context error, got %v", err)
+	}
+
+	defer setenv(map[string]string{"ARKENCTL_CONTEXT": "nope"})()
+	_, err = ApplyContext([]string{progname, "--config", path, "service", "list"}, GetGlobalFlags())
+	if err == nil {
+		t.Error("expected an unknown context error from ARKENCTL_CONTEXT")
+	}
+
+	// The context commands must still work to fix it
+	args := []string{progname, "--config", path, "context", "use", "prod"}
+	result, err := ApplyContext(args, GetGlobalFlags())
+	if err != nil || !reflect.DeepEqual(result, args) {
+		t.Errorf("expected the context command to be left as is, got %v, %v", result, err)
+	}
+}
+
+func TestApplyContextArgsAfterCommand(t *testing.T) {
+	path, cleanup := writeTestConfig(t)
+	defer cleanup()
+	defer setenv(cleanEnv)()
+
+	// Flags after the command belong to it, even if they have the name of a
+	// global flag
+	args := []string{progname, "--config", path, "service", "list", "--context", "nope", "--serviceDir", "/x"}
+	result, err := ApplyContext(args, GetGlobalFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{progname,
+		"--domainDir=/prod/domains",
+		"--driver=etcd",
+		"--dryRun=true",
+		"--etcdAddress=http://etcd1.prod:4001/,http://etcd2.prod:4001/",
+		"--rancherSecretKey=s3cr3t-k3y",
+		"--serviceDir=/prod/services",
+		"--config", path, "service", "list", "--context", "nope", "--serviceDir", "/x",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
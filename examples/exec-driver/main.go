@@ -0,0 +1,79 @@
+// Command exec-driver is a reference plugin for the exec driver of arkenctl :
+//
+//	arkenctl --driver exec:/path/to/exec-driver service start nxio_000001
+//
+// It reads the request on its standard input and answers as if the operation
+// succeeded at once. Services whose name starts with EXEC_DRIVER_FAIL_PREFIX,
+// if set, fail instead, to test error handling.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const protocolVersion = 1
+
+type request struct {
+	Version   int      `json:"version"`
+	Operation string   `json:"operation"`
+	Service   *service `json:"service"`
+}
+
+type service struct {
+	Name     string  `json:"name"`
+	Index    string  `json:"index"`
+	NodeKey  string  `json:"nodeKey"`
+	UnitName string  `json:"unitName"`
+	Status   *status `json:"status"`
+}
+
+type status struct {
+	Expected string `json:"expected"`
+	Current  string `json:"current"`
+	Alive    string `json:"alive"`
+}
+
+type response struct {
+	Version int     `json:"version"`
+	Status  *status `json:"status,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+func main() {
+	req := &request{}
+	if err := json.NewDecoder(os.Stdin).Decode(req); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid request : %v\n", err)
+		os.Exit(1)
+	}
+	if req.Version != protocolVersion {
+		fmt.Fprintf(os.Stderr, "unsupported protocol version %d\n", req.Version)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "%s %s/%s (%s)\n", req.Operation, req.Service.Name, req.Service.Index, req.Service.UnitName)
+
+	json.NewEncoder(os.Stdout).Encode(handle(req))
+}
+
+func handle(req *request) *response {
+	resp := &response{Version: protocolVersion}
+
+	if prefix := os.Getenv("EXEC_DRIVER_FAIL_PREFIX"); prefix != "" && strings.HasPrefix(req.Service.Name, prefix) {
+		resp.Error = "failure requested by EXEC_DRIVER_FAIL_PREFIX"
+		return resp
+	}
+
+	switch req.Operation {
+	case "start":
+		resp.Status = &status{Expected: "started", Current: "started", Alive: "1"}
+	case "stop":
+		resp.Status = &status{Expected: "stopped", Current: "stopped"}
+	case "passivate":
+		resp.Status = &status{Expected: "passivated", Current: "stopped"}
+	default:
+		resp.Error = fmt.Sprintf("unknown operation %s", req.Operation)
+	}
+	return resp
+}
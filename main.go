@@ -32,8 +32,11 @@ func main() {
 	flag.Usage = func() {}
 	flag.Parse()
 
+	args, err := ApplyContext(os.Args, app.Flags)
+	exitOnError(err)
+
 	glog.Infof("%s starting", progname)
-	app.Run(os.Args)
+	app.Run(args)
 }
 
 func handleSignals() {